@@ -1,18 +1,104 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
 
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/repl"
 )
 
+const usage = `usage:
+  monkey                        start the REPL
+  monkey run <file> [args...]   run a script
+  monkey <file> [args...]       run a script, e.g. from a #!/usr/bin/env monkey line
+  monkey -e <source> [args...]  evaluate source and print the result
+  monkey serve [serve options]  serve a REPL session on every connection
+
+options:
+  -engine eval|vm  execute with the tree-walking evaluator (default) or the bytecode vm
+  -max-depth n     stop after n nested function calls (default 10000)
+  -max-steps n     stop after n evaluated nodes or executed instructions
+  -time-limit d    stop an execution running for d, e.g. 5s
+  -max-memory n    stop after creating about n bytes of strings, arrays and hashes
+                   in total, over all the inputs of a REPL session until :reset
+
+serve options:
+  -listen address  tcp address (default localhost:4000), or unix:path of a socket
+  -shared          share one environment between the sessions
+  -timeout d       close the sessions idle for d, e.g. 10m
+`
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	source := flag.String("e", "", "evaluate `source`")
+	engineName := flag.String("engine", string(monkey.ENGINE_EVAL), "execution `engine`, eval or vm")
+	maxDepth := flag.Int("max-depth", 0, "maximum `number` of nested function calls")
+	maxSteps := flag.Int64("max-steps", 0, "maximum `number` of steps of an execution")
+	timeLimit := flag.Duration("time-limit", 0, "maximum `duration` of an execution")
+	maxMemory := flag.Int64("max-memory", 0, "maximum `bytes` allocated in total")
+	flag.Parse()
+	args := flag.Args()
+
+	options := monkey.Options{
+		Engine: monkey.Engine(*engineName),
+		Limits: object.Limits{
+			MaxDepth:  *maxDepth,
+			MaxSteps:  *maxSteps,
+			Timeout:   *timeLimit,
+			MaxMemory: *maxMemory,
+		},
+	}
+	if options.Engine != monkey.ENGINE_EVAL && options.Engine != monkey.ENGINE_VM {
+		fmt.Fprintf(os.Stderr, "monkey: unknown engine %q\n", *engineName)
+		flag.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	switch {
+	case isFlagSet("e"):
+		os.Exit(runSource("-e", *source, args, options, true))
+	case len(args) == 0:
+		startRepl(options)
+	case args[0] == "serve":
+		os.Exit(serve(args[1:], options))
+	case args[0] == "run":
+		if len(args) < 2 {
+			flag.Usage()
+			os.Exit(EXIT_USAGE)
+		}
+		os.Exit(runFile(args[1], args[2:], options))
+	default:
+		os.Exit(runFile(args[0], args[1:], options))
+	}
+}
+
+func startRepl(options monkey.Options) {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	repl.Start(os.Stdin, os.Stdout)
+	r := repl.New(options.Engine)
+	r.Limits = options.Limits
+	r.Banner = fmt.Sprintf("Hello %s! This is the Monkey programming language!\n", user.Username)
+	r.Stderr = os.Stderr
+	if err := r.Run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -12,6 +12,8 @@ type Node interface {
 	// returns the literal value of the token associated with
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 }
 
 type Statement interface {
@@ -26,6 +28,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // all comments in source order, see NewCommentMap
 }
 
 func (p *Program) TokenLiteral() string {
@@ -36,6 +39,19 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -67,6 +83,13 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return ls.Name.End()
+}
 
 type Identifier struct {
 	Token token.Token
@@ -78,6 +101,8 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
 
 // return <expression>;
 type ReturnStatement struct {
@@ -101,6 +126,13 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
@@ -118,6 +150,13 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -131,6 +170,23 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
 
 type PrefixExpression struct {
 	Token    token.Token
@@ -145,6 +201,8 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position { return pe.Right.End() }
 
 type InfixExpression struct {
 	Token    token.Token
@@ -160,6 +218,8 @@ func (oe *InfixExpression) expressionNode() {}
 func (oe *InfixExpression) TokenLiteral() string {
 	return oe.Token.Literal
 }
+func (oe *InfixExpression) Pos() token.Position { return oe.Left.Pos() }
+func (oe *InfixExpression) End() token.Position { return oe.Right.End() }
 
 type Boolean struct {
 	Token token.Token
@@ -173,6 +233,8 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) End() token.Position { return b.Token.End }
 
 // if (<condition>) <consequence> else <alternative>
 type IfExpression struct {
@@ -194,10 +256,18 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
 
 type BlockStatement struct {
 	Token      token.Token // token.LBRACE
 	Statements []Statement
+	Rbrace     token.Token // token.RBRACE
 }
 
 func (bs *BlockStatement) String() string {
@@ -212,6 +282,121 @@ func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.Pos.IsValid() {
+		return bs.Rbrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
+
+// while (<condition>) <body>
+type WhileStatement struct {
+	Token     token.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) String() string {
+	return fmt.Sprintf("while%s %s", ws.Condition.String(), ws.Body.String())
+}
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position { return ws.Body.End() }
+
+// for (<variable> in <iterable>) <body>
+type ForStatement struct {
+	Token    token.Token // token.FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) String() string {
+	return fmt.Sprintf("for(%s in %s) %s", fs.Variable.String(), fs.Iterable.String(), fs.Body.String())
+}
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position { return fs.Body.End() }
+
+type BreakStatement struct {
+	Token token.Token // token.BREAK
+}
+
+func (bs *BreakStatement) String() string { return "break;" }
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+type ContinueStatement struct {
+	Token token.Token // token.CONTINUE
+}
+
+func (cs *ContinueStatement) String() string { return "continue;" }
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
+
+// throw <expression>;
+type ThrowStatement struct {
+	Token token.Token // token.THROW
+	Value Expression
+}
+
+func (ts *ThrowStatement) String() string { return fmt.Sprintf("throw %s;", ts.Value.String()) }
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position { return ts.Value.End() }
+
+// try <block> catch (<parameter>) <block> finally <block>
+// either the catch or the finally clause can be omitted
+type TryExpression struct {
+	Token   token.Token // token.TRY
+	Block   *BlockStatement
+	Param   *Identifier // nil without a catch clause
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) String() string {
+	expr := fmt.Sprintf("try %s", te.Block.String())
+	if te.Catch != nil {
+		expr += fmt.Sprintf("catch(%s) %s", te.Param.String(), te.Catch.String())
+	}
+	if te.Finally != nil {
+		expr += fmt.Sprintf("finally %s", te.Finally.String())
+	}
+	return expr
+}
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position { return te.Token.Pos }
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	return te.Catch.End()
+}
 
 // fn <parameters> <block statement>
 // <parameters> = <parameter one>, <parameter two>, ...
@@ -219,6 +404,7 @@ type FunctionLiteral struct {
 	Token      token.Token // token.FUNCTION
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // name of the binding if the function is bound by let
 }
 
 func (fl *FunctionLiteral) String() string {
@@ -235,12 +421,15 @@ func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position { return fl.Body.End() }
 
 // <expression>(<comma separated expressions>)
 type CallExpression struct {
 	Token     token.Token // token.LPAREN
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen    token.Token // token.RPAREN
 }
 
 func (ce *CallExpression) String() string {
@@ -257,6 +446,8 @@ func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End }
 
 type StringLiteral struct {
 	Token token.Token
@@ -270,10 +461,41 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+// "a ${x} b"
+type TemplateLiteral struct {
+	Token token.Token  // token.TEMPLATE_HEAD
+	Parts []Expression // text parts(*StringLiteral) alternating with the embedded expressions
+	Tail  token.Token  // token.TEMPLATE_TAIL
+}
+
+func (tl *TemplateLiteral) String() string {
+	var out strings.Builder
+	out.WriteString("\"")
+	for i, part := range tl.Parts {
+		if i%2 == 0 {
+			out.WriteString(part.String())
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+func (tl *TemplateLiteral) expressionNode() {}
+func (tl *TemplateLiteral) TokenLiteral() string {
+	return tl.Token.Literal
+}
+func (tl *TemplateLiteral) Pos() token.Position { return tl.Token.Pos }
+func (tl *TemplateLiteral) End() token.Position { return tl.Tail.End }
 
 type ArrayLiteral struct {
 	Token    token.Token // token.LBRACKET
 	Elements []Expression
+	Rbracket token.Token // token.RBRACKET
 }
 
 func (al *ArrayLiteral) String() string {
@@ -290,11 +512,14 @@ func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
 
 type IndexExpression struct {
-	Token token.Token // token.LBRACKET
-	Left  Expression  // list
-	Index Expression
+	Token    token.Token // token.LBRACKET
+	Left     Expression  // list
+	Index    Expression
+	Rbracket token.Token // token.RBRACKET
 }
 
 func (ie *IndexExpression) String() string {
@@ -306,10 +531,13 @@ func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
 
 type HashLiteral struct {
-	Token token.Token // token.LBRACE
-	Pairs map[Expression]Expression
+	Token  token.Token // token.LBRACE
+	Pairs  map[Expression]Expression
+	Rbrace token.Token // token.RBRACE
 }
 
 func (hl *HashLiteral) String() string {
@@ -326,3 +554,51 @@ func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
+
+// <target> = <value>, or a compound assignment such as <target> += <value>
+type AssignExpression struct {
+	Token    token.Token // the assignment operator
+	Target   Expression  // *Identifier or *IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) String() string {
+	return fmt.Sprintf("(%s %s %s)", ae.Target.String(), ae.Operator, ae.Value.String())
+}
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Pos() token.Position { return ae.Target.Pos() }
+func (ae *AssignExpression) End() token.Position { return ae.Value.End() }
+
+// placeholder for an expression containing syntax errors
+type BadExpression struct {
+	Token token.Token // first token of the bad expression
+	Last  token.Token // last token of the bad expression
+}
+
+func (be *BadExpression) String() string  { return "<bad expression>" }
+func (be *BadExpression) expressionNode() {}
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+func (be *BadExpression) Pos() token.Position { return be.Token.Pos }
+func (be *BadExpression) End() token.Position { return be.Last.End }
+
+// placeholder for a statement containing syntax errors
+type BadStatement struct {
+	Token token.Token // first token of the bad statement
+	Last  token.Token // last token of the bad statement
+}
+
+func (bs *BadStatement) String() string { return "<bad statement>" }
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BadStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BadStatement) End() token.Position { return bs.Last.End }
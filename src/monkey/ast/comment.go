@@ -0,0 +1,95 @@
+package ast
+
+import "github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
+
+// a // line comment or a /* block comment */, only kept when the lexer
+// scans comments
+type Comment struct {
+	Token token.Token // token.COMMENT
+	Text  string      // including the comment markers
+}
+
+func (c *Comment) String() string { return c.Text }
+func (c *Comment) TokenLiteral() string {
+	return c.Token.Literal
+}
+func (c *Comment) Pos() token.Position { return c.Token.Pos }
+func (c *Comment) End() token.Position { return c.Token.End }
+
+// CommentMap maps a node to the comments attached to it, in source order
+type CommentMap map[Node][]*Comment
+
+// NewCommentMap attaches every comment of program to a node: a comment
+// following a statement on the same line belongs to that statement, a comment
+// inside a statement to the innermost such statement, and any other comment to
+// the statement after it. A comment which is followed by nothing but the end
+// of its block belongs to the block, or to the program at the top level.
+func NewCommentMap(program *Program) CommentMap {
+	var statements []Statement
+	var blocks []*BlockStatement
+	Inspect(program, func(n Node) bool {
+		switch n := n.(type) {
+		case *BlockStatement:
+			blocks = append(blocks, n)
+		case Statement:
+			statements = append(statements, n)
+		}
+		return true
+	})
+
+	cmap := CommentMap{}
+	for _, c := range program.Comments {
+		var owner Node = program
+		start, end := -1, -1 // span of the owner, -1 for the whole program
+		for _, b := range blocks {
+			if b.Pos().Offset < c.Pos().Offset && c.End().Offset <= b.End().Offset {
+				// blocks are in source order, later ones are nested deeper
+				owner, start, end = b, b.Pos().Offset, b.End().Offset
+			}
+		}
+
+		if s := attachedStatement(c, statements, start, end); s != nil {
+			owner = s
+		}
+		cmap[owner] = append(cmap[owner], c)
+	}
+	return cmap
+}
+
+// the statement between start and end which comment c belongs to, if any
+func attachedStatement(c *Comment, statements []Statement, start, end int) Statement {
+	inBlock := func(s Statement) bool {
+		return start < 0 || (start < s.Pos().Offset && s.End().Offset <= end)
+	}
+
+	var trailing, enclosing, next Statement
+	for _, s := range statements {
+		if !inBlock(s) {
+			continue
+		}
+
+		switch {
+		case s.End().Offset <= c.Pos().Offset && s.End().Line == c.Pos().Line:
+			if trailing == nil || s.End().Offset > trailing.End().Offset {
+				trailing = s
+			}
+		case s.Pos().Offset < c.Pos().Offset && c.End().Offset <= s.End().Offset:
+			if enclosing == nil || s.Pos().Offset > enclosing.Pos().Offset {
+				enclosing = s
+			}
+		case s.Pos().Offset >= c.End().Offset:
+			if next == nil || s.Pos().Offset < next.Pos().Offset {
+				next = s
+			}
+		}
+	}
+
+	switch {
+	case trailing != nil:
+		return trailing
+	case enclosing != nil:
+		return enclosing
+	default:
+		return next
+	}
+}
@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Fprint writes the tree rooted at node to w, one node per line indented by
+// its depth
+//
+//	LetStatement 1:1-1:11
+//	  Identifier 1:5-1:6 x
+//	  InfixExpression 1:9-1:14 +
+//	    IntegerLiteral 1:9-1:10 1
+//	    IntegerLiteral 1:13-1:14 2
+func Fprint(w io.Writer, node Node) error {
+	var err error
+	var print func(node Node, depth int)
+	print = func(node Node, depth int) {
+		if err != nil {
+			return
+		}
+		name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+		line := fmt.Sprintf("%s%s %s-%s", strings.Repeat("  ", depth), name, node.Pos(), node.End())
+		if detail := nodeDetail(node); detail != "" {
+			line += " " + detail
+		}
+		if _, err = io.WriteString(w, line+"\n"); err != nil {
+			return
+		}
+
+		Inspect(node, func(n Node) bool {
+			if n == node {
+				return true
+			}
+			print(n, depth+1)
+			return false
+		})
+	}
+	print(node, 0)
+
+	return err
+}
+
+// name, value or operator of node, if it has one
+func nodeDetail(node Node) string {
+	switch n := node.(type) {
+	case *Identifier:
+		return n.Value
+	case *IntegerLiteral, *FloatLiteral, *Boolean:
+		return n.TokenLiteral()
+	case *StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+	case *PrefixExpression:
+		return n.Operator
+	case *InfixExpression:
+		return n.Operator
+	case *AssignExpression:
+		return n.Operator
+	case *FunctionLiteral:
+		return n.Name
+	default:
+		return ""
+	}
+}
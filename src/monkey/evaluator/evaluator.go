@@ -2,6 +2,8 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
@@ -11,90 +13,146 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluates node in env, a Go panic during the evaluation is turned
+// into an error object instead of crashing the host
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer recoverPanic(&result)
+	return eval(node, env)
+}
+
+// Call applies fn, a function or a builtin, to args, the builtins use the
+// runtime of env. A Go panic is turned into an error object as in Eval
+func Call(fn object.Object, args []object.Object, env *object.Environment) (result object.Object) {
+	defer recoverPanic(&result)
+	return applyFunction(fn, args, env, nil)
+}
+
+func recoverPanic(result *object.Object) {
+	if r := recover(); r != nil {
+		*result = newError("internal error: %v", r)
+	}
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Runtime().Step(); err != nil {
+		return object.FatalError(err)
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
 
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(env.Runtime(), node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, env, false)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(node, env, false)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := evalTail(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ThrowStatement:
+		val := eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return object.Throw(val)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Name: node.Name}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		evaluated := evalTail(node, env)
+		call, ok := evaluated.(*object.TailCall)
+		if !ok {
+			return evaluated // error
 		}
-		return applyFunction(function, args)
+		return applyFunction(call.Fn, call.Args, env, call.Node)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		parts := evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isError(parts[0]) {
+			return parts[0]
+		}
+		return evalTemplateLiteral(env.Runtime(), parts)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if err := env.Runtime().Allocate(object.ArraySize(len(elements))); err != nil {
+			return object.FatalError(err)
+		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	}
 	return nil
 }
@@ -103,10 +161,13 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
+			if call, ok := result.Value.(*object.TailCall); ok {
+				return applyFunction(call.Fn, call.Args, env, call.Node)
+			}
 			return result.Value
 		case *object.Error:
 			return result
@@ -157,23 +218,29 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(rt *object.Runtime, operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// mixed integer and float operands are promoted to float
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return evalStringInfixExpression(rt, operator, left, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -181,6 +248,20 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// && and || evaluate to the operand which decided the result, the right
+// operand is only evaluated when the left one doesn't decide it
+func evalLogicalExpression(
+	node *ast.InfixExpression,
+	left object.Object,
+	env *object.Environment,
+) object.Object {
+
+	if isTruthy(left) == (node.Operator == "||") {
+		return left
+	}
+	return eval(node.Right, env)
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
@@ -193,11 +274,55 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -207,30 +332,63 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	cond := Eval(ie.Condition, env)
+// evalTail evaluates node in tail position, where its value is the value of
+// the function evaluating it. A call there is returned as a TailCall for
+// applyFunction to apply once the function returned
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env, true)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env, true)
+	case *ast.CallExpression:
+		function := eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return &object.TailCall{Fn: function, Args: args, Node: node}
+	default:
+		return eval(node, env)
+	}
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
+	cond := eval(ie.Condition, env)
 	if isError(cond) {
 		return cond
 	}
 
 	if isTruthy(cond) {
-		return Eval(ie.Consequence, env)
+		return evalBlockStatement(ie.Consequence, env, tail)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return evalBlockStatement(ie.Alternative, env, tail)
 	} else {
 		return NULL
 	}
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// evalBlockStatement evaluates the statements of block, the last one in tail
+// position if tail is set
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
 	var result object.Object
 
-	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+	for i, stmt := range block.Statements {
+		if tail && i == len(block.Statements)-1 {
+			result = evalTail(stmt, env)
+		} else {
+			result = eval(stmt, env)
+		}
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -238,11 +396,115 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result, done := evalLoopBody(ws.Body, env)
+		if done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for _, item := range it.Items() {
+		env.Set(fs.Variable.Value, item)
+
+		result, done := evalLoopBody(fs.Body, env)
+		if done {
+			return result
+		}
+	}
+	return NULL
+}
+
+// runs one iteration, done reports whether the loop has to stop with result
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := evalBlockStatement(body, env, false)
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	}
+	return nil, false
+}
+
+// evalTryExpression evaluates the block, then the catch clause if the block
+// failed with an error which isn't fatal, then the finally clause whatever
+// happened. An error, return, break or continue from the finally clause
+// replaces the result
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := evalGuarded(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && !err.Fatal && te.Catch != nil {
+		env.Set(te.Param.Value, &object.ErrorValue{Err: err})
+		result = evalGuarded(te.Catch, env)
+	}
+
+	if te.Finally != nil {
+		if err, ok := result.(*object.Error); ok && err.Fatal {
+			return result
+		}
+		finally := evalBlockStatement(te.Finally, env, false)
+		if finally != nil {
+			switch finally.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return finally
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// evalGuarded evaluates a block of a try expression. A call returned in
+// tail position is applied right away so that its errors are caught and the
+// finally clause runs after it
+func evalGuarded(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := evalBlockStatement(block, env, false)
+
+	if rv, ok := result.(*object.ReturnValue); ok {
+		if call, ok := rv.Value.(*object.TailCall); ok {
+			value := applyFunction(call.Fn, call.Args, env, call.Node)
+			if isError(value) {
+				return value
+			}
+			return &object.ReturnValue{Value: value}
+		}
+	}
+	return result
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -251,12 +513,29 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+// concatenation of the rendered parts of a template
+func evalTemplateLiteral(rt *object.Runtime, parts []object.Object) object.Object {
+	texts := make([]string, len(parts))
+	size := 0
+	for i, part := range parts {
+		texts[i] = part.Inspect()
+		size += len(texts[i])
+	}
+	if err := rt.Allocate(object.StringSize(size)); err != nil {
+		return object.FatalError(err)
+	}
+	return &object.String{Value: strings.Join(texts, "")}
+}
+
+func evalStringInfixExpression(rt *object.Runtime, operator string, left, right object.Object) object.Object {
 	if operator != "+" {
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
+	if err := rt.Allocate(object.StringSize(len(leftVal) + len(rightVal))); err != nil {
+		return object.FatalError(err)
+	}
 	return &object.String{Value: leftVal + rightVal}
 }
 
@@ -264,13 +543,116 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.ErrorValue).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	// x += v is x = x + v
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if operator != "" {
+			current = evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(operator, current, node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if !env.Assign(target.Value, val) {
+			if _, ok := builtins[target.Value]; ok {
+				return newError("cannot assign to builtin: %s", target.Value)
+			}
+			return newError("identifier not found: " + target.Value)
+		}
+		return val
+	case *ast.IndexExpression:
+		left := eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if operator != "" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(operator, current, node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalIndexAssignment(env.Runtime(), left, index, val)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// the value of an assignment, combined with the current value of the target
+// for a compound assignment
+func evalAssignedValue(
+	operator string,
+	current object.Object,
+	value ast.Expression,
+	env *object.Environment,
+) object.Object {
+
+	val := eval(value, env)
+	if isError(val) || operator == "" {
+		return val
+	}
+	return evalInfixExpression(env.Runtime(), operator, current, val)
+}
+
+func evalIndexAssignment(rt *object.Runtime, left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		array := left.(*object.Array)
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(array.Elements)) {
+			return newError("index out of range: %d", i)
+		}
+		array.Elements[i] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		hash := left.(*object.Hash)
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		if _, ok := hash.Pairs[key.HashKey()]; !ok {
+			if err := rt.Allocate(object.HASH_PAIR_SIZE); err != nil {
+				return object.FatalError(err)
+			}
+		}
+		hash.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -295,6 +677,21 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -302,14 +699,86 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction applies fn to args, then the tail calls it returns one after
+// another, so that tail recursion runs in constant Go stack. A tail call
+// still counts as a nested call until the chain returns, so that an endless
+// tail recursion stops at the maximum depth as on the vm. An error is given
+// the frame of the call at node, if any
+func applyFunction(
+	fn object.Object,
+	args []object.Object,
+	env *object.Environment,
+	node *ast.CallExpression,
+) object.Object {
+
+	rt := env.Runtime()
+	depth := 0
+	defer func() {
+		for ; depth > 0; depth-- {
+			rt.Leave()
+		}
+	}()
+
+	for {
+		result := callFunction(fn, args, env)
+		if call, ok := result.(*object.TailCall); ok {
+			fn, args, node = call.Fn, call.Args, call.Node
+			if err := rt.Enter(); err != nil {
+				result = object.FatalError(err)
+			} else {
+				depth += 1
+				continue
+			}
+		}
+
+		switch result := result.(type) {
+		case *object.Error:
+			if node != nil {
+				result.Stack = append(result.Stack, callFrame(fn, node))
+			}
+			return result
+		default:
+			return result
+		}
+	}
+}
+
+// frame of the call of fn at node, named after the function or the
+// identifier of a builtin
+func callFrame(fn object.Object, node *ast.CallExpression) object.Frame {
+	frame := object.Frame{Pos: node.Pos(), End: node.End()}
+	switch fn := fn.(type) {
+	case *object.Function:
+		frame.Function = fn.Name
+	case *object.Builtin:
+		if ident, ok := node.Function.(*ast.Identifier); ok {
+			frame.Function = ident.Value
+		}
+	}
+	return frame
+}
+
+// callFunction applies fn to args, returning the call in tail position of its
+// body as a TailCall
+func callFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		rt := env.Runtime()
+		if err := rt.Enter(); err != nil {
+			return object.FatalError(err)
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		evaluated := evalTail(fn.Body, extendedEnv)
+		rt.Leave()
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(env.Runtime(), args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -344,6 +813,14 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	ch, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+	return ch
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
@@ -362,7 +839,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
@@ -372,7 +849,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -380,5 +857,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
+	if err := env.Runtime().Allocate(object.HashSize(len(pairs))); err != nil {
+		return object.FatalError(err)
+	}
 	return &object.Hash{Pairs: pairs}
 }
@@ -1,8 +1,12 @@
 package evaluator
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
@@ -23,6 +27,25 @@ func TestErrorHandling(t *testing.T) {
 		{"foobar", "identifier not found: foobar"},
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
 		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{"1 / 0", "division by zero"},
+		{"let x = 0; 10 / x", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{`"a" <= "b"`, "unknown operator: STRING <= STRING"},
+		{"true && 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"fn(a, b) { a }(1)", "wrong number of arguments: want=2, got=1"},
+		{"let f = fn() { 1 }; f(1, 2)", "wrong number of arguments: want=0, got=2"},
+		{"for (x in 1) { x }", "cannot iterate over INTEGER"},
+		{"while (true) { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"x = 1", "identifier not found: x"},
+		{"let f = fn() { y += 1 }; f()", "identifier not found: y"},
+		{"len = 1", "cannot assign to builtin: len"},
+		{"let a = [1]; a[5] = 1", "index out of range: 5"},
+		{`let s = "a"; s[0] = "b"`, "index assignment not supported: STRING"},
+		{"let f = fn(x) { f(x) }; f(1)", "maximum recursion depth exceeded"},
+		{"let f = fn(x) { 1 + f(x) }; f(1)", "maximum recursion depth exceeded"},
+		{`throw "boom"`, "boom"},
+		{`try { throw "a" } finally { 1 }`, "a"},
+		{`let f = fn() { throw "a" }; try { f() } catch (e) { e + 1 }`, "type mismatch: ERROR_VALUE + INTEGER"},
 	}
 
 	for _, tt := range tests {
@@ -39,6 +62,133 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // frames, innermost first
+	}{
+		{"1 + true", []string{}},
+		{"let f = fn() { 1 + true }; f()", []string{"f (1:28)"}},
+		{`
+let add = fn(a, b) { a + b };
+let compute = fn(x) { let y = add(x, "a"); y };
+compute(2)`, []string{"add (3:31)", "compute (4:1)"}},
+		{"let f = fn() { len(1) + 1 }; f()", []string{"len (1:16)", "f (1:30)"}},
+		{"fn() { 1 + true; 1 }()", []string{"1:1"}},
+		// a tail call replaces the frame of its caller
+		{"let g = fn() { 1 + true; 1 }; let f = fn() { g() }; f()", []string{"g (1:46)"}},
+		{"let f = fn() { 1 + true; 1 }; let a = [f]; a[0]()", []string{"f (1:44)"}},
+		// a rethrown error keeps its stack
+		{"let f = fn() { 1 + true; 1 }; let g = fn() { try { f() } catch (e) { throw e } 1 }; g()", []string{"f (1:52)", "g (1:85)"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		frames := []string{}
+		for _, frame := range errObj.Stack {
+			frames = append(frames, frame.String())
+		}
+		if strings.Join(frames, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("wrong stack for %q. expected=%q, got=%q", tt.input, tt.expected, frames)
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// a malformed tree which makes the evaluator dereference nil
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.PrefixExpression{Operator: "-"}},
+	}}
+
+	evaluated := Eval(program, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          object.Limits
+		expectedMessage string // "" if the evaluation succeeds
+	}{
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.Limits{MaxDepth: 11}, ""},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.Limits{MaxDepth: 10}, "maximum recursion depth exceeded"},
+		{"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(10)", object.Limits{MaxDepth: 11}, ""},
+		{"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(10)", object.Limits{MaxDepth: 10}, "maximum recursion depth exceeded"},
+		{"1 + 2", object.Limits{MaxSteps: 5}, ""},
+		{"while (true) { }", object.Limits{MaxSteps: 1000}, "maximum number of steps exceeded"},
+		{"while (true) { }", object.Limits{Timeout: time.Millisecond}, "execution timed out"},
+		{`"a" + "b"`, object.Limits{MaxMemory: 100}, ""},
+		// like the constants of the vm, literals aren't counted
+		{`let i = 0; while (i < 1000) { "abcdefgh"; i += 1 }`, object.Limits{MaxMemory: 100}, ""},
+		{`let s = "ab"; while (true) { s = s + s }`, object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{`let s = "ab"; while (true) { s = "${s}${s}" }`, object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let a = []; while (true) { a = push(a, 1) }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"while (true) { [1, 2, 3] }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let h = {}; let i = 0; while (true) { h[i] = i; i += 1 }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let h = {}; while (true) { h[1] = 1 }", object.Limits{MaxMemory: 1 << 20, MaxSteps: 100000}, "maximum number of steps exceeded"},
+		// the limits can't be caught
+		{"try { while (true) { } } catch (e) { 1 }", object.Limits{MaxSteps: 1000}, "maximum number of steps exceeded"},
+		{"let a = []; try { while (true) { a = push(a, 1) } } catch (e) { 1 }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let f = fn() { 1 + f() }; try { f() } finally { 1 }", object.Limits{MaxDepth: 10}, "maximum recursion depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Runtime().Limits = tt.limits
+		end := env.Runtime().Begin(context.Background())
+		evaluated := Eval(parse(tt.input), env)
+		end()
+
+		errObj, ok := evaluated.(*object.Error)
+		if tt.expectedMessage == "" {
+			if ok {
+				t.Errorf("unexpected error for %q: %s", tt.input, errObj.Message)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	env := object.NewEnvironment()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer env.Runtime().Begin(ctx)()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	evaluated := Eval(parse("let i = 0; while (true) { i += 1 }"), env)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "execution cancelled" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
 func TestEvalIntegerExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -59,6 +209,10 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 7 % 4 * 2", 8},
+		{"let x = 7; x %= 4; x", 3},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +221,29 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"0.5", 0.5},
+		{"1e-3", 0.001},
+		{"-2.5", -2.5},
+		{"0.5 + 0.25", 0.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"1 / 4.0", 0.25},
+		{"10 - 2.5 * 2", 5},
+		{"5.5 % 2", 1.5},
+		{"-7 % 2.5", -2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -91,6 +268,16 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"0.5 < 1", true},
+		{"1.5 > 2", false},
+		{"1 == 1.0", true},
+		{"2.5 != 2.5", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 >= 1", true},
+		{"1 <= 0.5", false},
 	}
 
 	for _, tt := range tests {
@@ -99,6 +286,37 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && 1", 1},
+		{"0 && 1", 1},
+		{"false && 1", false},
+		{"false || 2", 2},
+		{"1 || 2", 1},
+		{"let n = if (false) { 1 }; n || 3", 3},
+		{"let x = 0; false && (x = 1); x", 0},
+		{"let x = 0; true || (x = 1); x", 0},
+		{"let x = 0; true && (x = 1); x", 1},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 >= 3", false},
+		{"let f = fn(n) { n <= 1 || f(n - 1) }; f(5)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -144,6 +362,114 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1; }; i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i", 3},
+		{"let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 2) { continue; } let s = s + i; }; s", 13},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { let s = s + k; }; s`, "ab"},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } let n = n + 1; } }; n", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([1, 2, 3])", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([])", nil},
+		{"let f = fn() { let s = 0; for (x in [1, 2, 3]) { let s = s + x; } s }; f()", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected String %q, got %T (%+v) instead", expected, evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{"try { 1 } catch (e) { 2 }", 1},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { throw error("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { throw [1, 2] } catch (e) { e["message"] }`, "[1, 2]"},
+		{`let e = try { throw "x" } catch (err) { err }; e["unknown"]`, nil},
+		{`let f = fn() { throw 1 + 2 }; try { f() } catch (e) { e["message"] }`, "3"},
+		{`let f = fn(n) { if (n == 0) { throw "deep" } 1 + f(n - 1) }; let r = try { f(10) } catch (e) { 0 }; r + 1`, 1},
+		{`let f = fn() { try { 1 + true } catch (e) { throw e } }; try { f() } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw "a" } catch (e) { try { throw e["message"] + "b" } catch (e) { e["message"] } }`, "ab"},
+		{`let g = fn() { throw "t" }; let f = fn() { try { return g() } catch (e) { "caught" } }; f()`, "caught"},
+		{`let log = ""; let x = try { 1 } finally { log += "f" }; log + "${x}"`, "f1"},
+		{`let log = ""; try { try { throw "a" } finally { log += "f" } } catch (e) { log + e["message"] }`, "fa"},
+		{`let log = ""; try { try { throw "a" } catch (e) { throw "b" } finally { log += "f" } } catch (e) { log + e["message"] }`, "fb"},
+		{`let log = ""; let f = fn() { try { return "r" } finally { log += "f" } }; f() + log`, "rf"},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{`let f = fn() { try { throw "a" } finally { return 1 } }; f()`, 1},
+		{`let log = ""; for (x in [1, 2, 3]) { try { if (x == 2) { continue } log += "${x}" } finally { log += "f" } }; log`, "1ff3f"},
+		{`let log = ""; for (x in [1, 2, 3]) { try { if (x == 2) { break } } finally { log += "${x}" } }; log`, "12"},
+		{`let log = ""; try { for (x in [1, 2]) { if (x == 2) { break } } log += "a" } finally { log += "f" }; log`, "af"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected String %q, got %T (%+v) instead", tt.input, expected, evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 1; x -= 3; x", -2},
+		{"let x = 3; x *= 3; x", 9},
+		{"let x = 9; x /= 2; x", 4},
+		{"let x = 1; let y = x = 5; x + y", 10},
+		{"let n = 0; let f = fn() { n = n + 5 }; f(); f(); n", 10},
+		{"let f = fn(x) { x *= 2; x }; f(4)", 8},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let n = 0; let g = fn() { fn() { n += 1 } }; g()(); g()(); n }; f()", 2},
+		{"let make = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let p = make(); p[0](); p[0](); p[1]()", 2},
+		{"let f = fn(v) { let x = v; fn() { x } }; let a = f(1); let b = f(2); a() + b() * 10", 21},
+		{"let f = fn() { f = 1; 2 }; f(); f", 1},
+		{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+		{"let a = [1, 2]; a[0] += 10; a[0]", 11},
+		{`let h = {}; h["a"] = 1; h["a"] += 1; h["a"]`, 2},
+		{"let s = 0; let i = 0; while (i < 4) { i += 1; s += i }; s", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -221,6 +547,63 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestTailCalls(t *testing.T) {
+	// tail calls count toward the depth but don't grow the Go stack
+	limits := object.Limits{MaxDepth: 1 << 20}
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)", 100000},
+		{"let count = fn(n) { if (n == 0) { return \"done\"; } return count(n - 1); }; count(100000)", "done"},
+		{"let count = fn(n) { while (true) { if (n == 0) { return 0 } return count(n - 1) } }; count(100000)", 0},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(100001)`, false},
+		{`
+let iter = fn(arr, i, acc) {
+	if (i == 0) { return acc; }
+	let acc = acc + arr[i - 1];
+	iter(arr, i - 1, acc)
+};
+let arr = [];
+let i = 0;
+while (i < 100) { arr = push(arr, i); i += 1 }
+let sum = fn(n) { if (n == 0) { 0 } else { iter(arr, 100, 0) + sum(n - 1) } };
+sum(3)`, 3 * 4950},
+		{"let f = fn(a) { push(a, 1) }; f([])[0]", 1},
+		{"let f = fn(n) { n * 2 }; return f(21);", 42},
+		{"let f = fn() { g() }; f()", "identifier not found: g"},
+		{"let f = fn() { 1() }; f()", "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Runtime().Limits = limits
+		evaluated := Eval(parse(tt.input), env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("String has wrong value. got=%q", evaluated.Value)
+				}
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, evaluated.Message)
+				}
+			default:
+				t.Errorf("unexpected object for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
 func TestClousures(t *testing.T) {
 	input := `
 		let newAdder = fn(x) {
@@ -246,6 +629,66 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"héllo"[0]`, "h"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain ${"text"}"`, "plain text"},
+		{`let x = 5; "x = ${x}, twice ${x * 2}"`, "x = 5, twice 10"},
+		{`"${[1, "a"]} ${true} ${1.5} ${if (false) { 1 }}"`, "[1, a] true 1.5 null"},
+		{`let n = "w"; "a ${"b ${n}"} c"`, "a b w c"},
+		{`"cost: \${5}"`, "cost: ${5}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"${-true}"`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "unknown operator: -BOOLEAN" {
+		t.Errorf("expected error, got %T (%+v) instead", evaluated, evaluated)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	evaluated := testEval(input)
@@ -266,6 +709,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -288,6 +732,47 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+// the array builtins as shared with the vm, which fixed push on an empty
+// array (null before) and the messages of last, rest and push
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`push([], 1)`, []int64{1}},
+		{`push([1], 2)`, []int64{1, 2}},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`push([1])`, "wrong number of arguments. got=1, want=2"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest(1)`, "argument to `rest` must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("%q: expected Array %v, got %T (%+v) instead", tt.input, expected, evaluated, evaluated)
+				continue
+			}
+			for i, n := range expected {
+				testIntegerObject(t, array.Elements[i], n)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -397,12 +882,13 @@ func TestHashIndexExpressions(t *testing.T) {
 }
 
 func testEval(input string) object.Object {
+	return Eval(parse(input), object.NewEnvironment())
+}
+
+func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
-
-	return Eval(program, env)
+	return p.ParseProgram()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -418,6 +904,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -1,32 +1,113 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
 )
 
-const NUL byte = 0
+const NUL rune = 0
+
+// codes of the lexical errors
+const (
+	UNTERMINATED_STRING  = "unterminated-string"
+	UNTERMINATED_COMMENT = "unterminated-comment"
+	INVALID_CHARACTER    = "invalid-character"
+	INVALID_ESCAPE       = "invalid-escape"
+)
+
+// Error describes malformed source found while scanning
+type Error struct {
+	Pos  token.Position // start of the malformed source
+	End  token.Position // end of the malformed source
+	Code string
+	Msg  string
+}
+
+// <position>: <message>
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Mode controls the optional behaviour of a lexer
+type Mode uint
+
+const (
+	SCAN_COMMENTS Mode = 1 << iota // return comments as COMMENT tokens instead of skipping them
+)
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input(points to current char)
-	readPosition int  // current reading position in input(points to next char)
-	ch           byte // current char under examination
+	position     int  // current byte offset in input(points to current char)
+	readPosition int  // current reading offset in input(points to next char)
+	ch           rune // current char under examination
+
+	filename string
+	line     int // line of current char
+	column   int // column of current char
+
+	mode   Mode
+	errors []Error
+
+	// number of unclosed braces inside each open ${ of a template
+	templates []int
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile returns a lexer whose token positions refer to filename
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// Errors returns the lexical errors found so far, in the order of the source
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+func (l *Lexer) error(pos, end token.Position, code, msg string) {
+	l.errors = append(l.errors, Error{Pos: pos, End: end, Code: code, Msg: msg})
+}
+
+// SetMode changes the mode of the lexer for the tokens read after the call
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
 
+func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		pos := l.pos()
+		comment := l.readComment()
+		if l.mode&SCAN_COMMENTS != 0 {
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos, End: l.pos()}
+		}
+		l.skipWhitespace()
+	}
+
+	pos := l.pos()
+	tok := l.nextToken()
+	tok.Pos = pos
+	tok.End = l.pos()
+
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -37,9 +118,19 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		tok = newToken(token.BANG, l.ch)
 		if l.peekChar() == '=' {
@@ -49,13 +140,54 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PERCENT_ASSIGN, Literal: "%="}
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = l.illegalChar()
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = l.illegalChar()
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case ';':
@@ -67,12 +199,23 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1] += 1
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		if n := len(l.templates); n > 0 && l.templates[n-1] == 0 {
+			// end of the embedded expression, the template continues
+			l.templates = l.templates[:n-1]
+			tok = l.readStringToken(token.TEMPLATE_TAIL, token.TEMPLATE_MIDDLE)
+		} else {
+			if n > 0 {
+				l.templates[n-1] -= 1
+			}
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringToken(token.STRING, token.TEMPLATE_HEAD)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -80,40 +223,108 @@ func (l *Lexer) NextToken() token.Token {
 	case NUL:
 		tok.Literal = ""
 		tok.Type = token.EOF
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent((tok.Literal))
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.illegalChar()
 		}
 	}
 	l.readChar()
 	return tok
 }
 
-// read one chacater and advance our position in the input string
+// ILLEGAL token of the current char
+func (l *Lexer) illegalChar() token.Token {
+	msg := fmt.Sprintf("invalid character %q", l.ch)
+	if l.ch == utf8.RuneError {
+		msg = "invalid UTF-8 encoding"
+	}
+	l.error(l.pos(), l.endPos(), INVALID_CHARACTER, msg)
+	return newToken(token.ILLEGAL, l.ch)
+}
+
+// read one chacater and advance our position in the input string, invalid
+// UTF-8 is read one byte at a time as utf8.RuneError
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = NUL
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
+	l.column += 1
 }
 
-func (l *Lexer) readNumber() string {
+// position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// position immediately after the current char
+func (l *Lexer) endPos() token.Position {
+	pos := l.pos()
+	pos.Offset = l.readPosition
+	pos.Column += 1
+	return pos
+}
+
+// integer(123) or float(1.5, 1e-3, 2.5E+10)
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	pos := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+
+	return l.input[pos:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[pos:l.position]
+}
+
+// whether the `e` under examination starts an exponent like e10, e+10 or e-10
+func (l *Lexer) isExponent() bool {
+	next := l.peekChar()
+	if next == '+' || next == '-' {
+		if l.readPosition+1 >= len(l.input) {
+			return false
+		}
+		next = rune(l.input[l.readPosition+1])
+	}
+	return isDigit(next)
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -130,29 +341,163 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// read a // comment up to the end of the line, or a /* comment */
+func (l *Lexer) readComment() string {
+	start := l.pos()
+	pos := l.position
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != NUL {
+			l.readChar()
+		}
+		return l.input[pos:l.position]
+	}
+
+	l.readChar() // '/'
+	l.readChar() // '*'
+	for l.ch != NUL && !(l.ch == '*' && l.peekChar() == '/') {
+		l.readChar()
+	}
+	if l.ch == NUL {
+		l.error(start, l.pos(), UNTERMINATED_COMMENT, "unterminated block comment")
+		return l.input[pos:l.position]
+	}
+	l.readChar() // '*'
+	l.readChar() // '/'
+	return l.input[pos:l.position]
+}
+
+// skip a `#!/usr/bin/env monkey` line at the start of a script
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != NUL {
+		l.readChar()
+	}
+}
+
 // peek next char
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return NUL
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
-func (l *Lexer) readString() string {
-	pos := l.position + 1
+// token of a string literal, or of the template text starting at the current
+// char, whose type is closed if it ends with the closing quote and open if
+// it ends with ${
+func (l *Lexer) readStringToken(closed, open token.TokenType) token.Token {
+	start := l.position
+	value, ok := l.readString()
+	switch {
+	case l.ch == '{':
+		l.templates = append(l.templates, 0)
+		return token.Token{Type: open, Literal: value}
+	case ok || closed != token.STRING && l.ch == '"':
+		return token.Token{Type: closed, Literal: value}
+	default:
+		end := l.position
+		if l.ch == '"' {
+			end += 1
+		}
+		return token.Token{Type: token.ILLEGAL, Literal: l.input[start:end]}
+	}
+}
+
+// read a string literal up to the closing quote or the { of ${, decoding its
+// escape sequences, ok is false if it is unterminated or contains an invalid
+// escape sequence
+func (l *Lexer) readString() (value string, ok bool) {
+	var out strings.Builder
+	start := l.pos()
+	ok = true
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == NUL {
-			break
+		switch l.ch {
+		case '"':
+			return out.String(), ok
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				continue
+			}
+			l.readChar()
+			return out.String(), ok
+		case NUL:
+			l.error(start, l.pos(), UNTERMINATED_STRING, "unterminated string literal")
+			return out.String(), false
+		case '\\':
+			escape := l.pos()
+			l.readChar()
+			ch, valid := l.readEscape()
+			if !valid {
+				ok = false
+				if l.ch == NUL {
+					l.error(start, l.pos(), UNTERMINATED_STRING, "unterminated string literal")
+					return out.String(), ok
+				}
+				msg := fmt.Sprintf("invalid escape sequence %s", l.input[escape.Offset:l.readPosition])
+				l.error(escape, l.endPos(), INVALID_ESCAPE, msg)
+			}
+			out.WriteRune(ch)
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
-	return l.input[pos:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// decode the escape sequence after a backslash: \n \t \r \" \\ \$ or \u{hex}
+func (l *Lexer) readEscape() (rune, bool) {
+	switch l.ch {
+	case '$':
+		return '$', true
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case 'r':
+		return '\r', true
+	case '"':
+		return '"', true
+	case '\\':
+		return '\\', true
+	case 'u':
+		if l.peekChar() != '{' {
+			return utf8.RuneError, false
+		}
+		l.readChar()
+
+		pos := l.readPosition
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		digits := l.input[pos:l.readPosition]
+		if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+			return utf8.RuneError, false
+		}
+		l.readChar()
+
+		code, _ := strconv.ParseUint(digits, 16, 32)
+		if !utf8.ValidRune(rune(code)) {
+			return utf8.RuneError, false
+		}
+		return rune(code), true
+	default:
+		return utf8.RuneError, false
+	}
 }
 
-func isDigit(ch byte) bool {
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
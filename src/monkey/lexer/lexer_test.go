@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T) {
 		};
 		let result = add(five, ten);
 
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -31,6 +31,9 @@ func TestNextToken(t *testing.T) {
 		"foo bar"
 		[1, 2];
 		{"foo": "bar"}
+		x += 1 -= 2 *= 3 /= 4;
+		a <= b >= c % d && e || f %= 1;
+		try catch finally throw
 	`
 	cases := []struct {
 		expectedType    token.TokenType
@@ -122,6 +125,289 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.THROW, "throw"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for _, tc := range cases {
+		tok := l.NextToken()
+		if tok.Type != tc.expectedType {
+			t.Fatalf("Expected TokenType %q, got %q instead\n", tc.expectedType, tok.Type)
+		}
+		if tok.Literal != tc.expectedLiteral {
+			t.Fatalf("Expected Literal %q, got %q instead\n", tc.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  \"foo\" != x;"
+
+	cases := []struct {
+		expectedType token.TokenType
+		expectedPos  [3]int // offset, line, column
+		expectedEnd  [3]int
+	}{
+		{token.LET, [3]int{0, 1, 1}, [3]int{3, 1, 4}},
+		{token.IDENT, [3]int{4, 1, 5}, [3]int{5, 1, 6}},
+		{token.ASSIGN, [3]int{6, 1, 7}, [3]int{7, 1, 8}},
+		{token.INT, [3]int{8, 1, 9}, [3]int{9, 1, 10}},
+		{token.SEMICOLON, [3]int{9, 1, 10}, [3]int{10, 1, 11}},
+		{token.STRING, [3]int{13, 2, 3}, [3]int{18, 2, 8}},
+		{token.NOT_EQ, [3]int{19, 2, 9}, [3]int{21, 2, 11}},
+		{token.IDENT, [3]int{22, 2, 12}, [3]int{23, 2, 13}},
+		{token.SEMICOLON, [3]int{23, 2, 13}, [3]int{24, 2, 14}},
+		{token.EOF, [3]int{24, 2, 14}, [3]int{24, 2, 14}},
+	}
+
+	l := NewFile("test.mk", input)
+	for _, tc := range cases {
+		tok := l.NextToken()
+		if tok.Type != tc.expectedType {
+			t.Fatalf("Expected TokenType %q, got %q instead\n", tc.expectedType, tok.Type)
+		}
+		if pos := [3]int{tok.Pos.Offset, tok.Pos.Line, tok.Pos.Column}; pos != tc.expectedPos {
+			t.Errorf("Expected Pos %v for %q, got %v instead\n", tc.expectedPos, tok.Literal, pos)
+		}
+		if end := [3]int{tok.End.Offset, tok.End.Line, tok.End.Column}; end != tc.expectedEnd {
+			t.Errorf("Expected End %v for %q, got %v instead\n", tc.expectedEnd, tok.Literal, end)
+		}
+		if tok.Pos.Filename != "test.mk" {
+			t.Errorf("Expected Filename %q, got %q instead\n", "test.mk", tok.Pos.Filename)
+		}
+	}
+
+	if s := l.NextToken().Pos.String(); s != "test.mk:2:14" {
+		t.Errorf("Expected position string %q, got %q instead\n", "test.mk:2:14", s)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nputs(1);"
+
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != token.IDENT || tok.Literal != "puts" {
+		t.Fatalf("Expected IDENT \"puts\", got %q %q instead\n", tok.Type, tok.Literal)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Errorf("Expected token at 2:1, got %s instead\n", tok.Pos)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// line\nlet x = 1; /* block\n*/ x / 2 // end\n/* open"
+
+	tests := []struct {
+		mode     Mode
+		expected []token.Token
+	}{
+		{
+			0,
+			[]token.Token{
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			SCAN_COMMENTS,
+			[]token.Token{
+				{Type: token.COMMENT, Literal: "// line"},
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.COMMENT, Literal: "/* block\n*/"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.COMMENT, Literal: "// end"},
+				{Type: token.COMMENT, Literal: "/* open"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(input)
+		l.SetMode(tt.mode)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("mode %d, token %d: expected %s %q, got %s %q instead",
+					tt.mode, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+
+	l := New(input)
+	l.SetMode(SCAN_COMMENTS)
+	l.NextToken()
+	for i := 0; i < 5; i++ {
+		l.NextToken()
+	}
+	block := l.NextToken()
+	if block.Pos.String() != "2:12" || block.End.String() != "3:3" {
+		t.Errorf("expected block comment to span 2:12-3:3, got %s-%s instead", block.Pos, block.End)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"a\nb\t\"c\"\\" "h\u{e9}llo \u{1F600}" "héllo" "bad\q" "\u{110000}" 名前 café`
+
+	cases := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\nb\t\"c\"\\"},
+		{token.STRING, "héllo 😀"},
+		{token.STRING, "héllo"},
+		{token.ILLEGAL, `"bad\q"`},
+		{token.ILLEGAL, `"\u{110000}"`},
+		{token.IDENT, "名前"},
+		{token.IDENT, "café"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for _, tc := range cases {
+		tok := l.NextToken()
+		if tok.Type != tc.expectedType {
+			t.Fatalf("Expected TokenType %q, got %q instead\n", tc.expectedType, tok.Type)
+		}
+		if tok.Literal != tc.expectedLiteral {
+			t.Fatalf("Expected Literal %q, got %q instead\n", tc.expectedLiteral, tok.Literal)
+		}
+	}
+
+	// columns count characters, not bytes
+	l = New(`"é" x`)
+	l.NextToken()
+	if tok := l.NextToken(); tok.Pos.Column != 5 || tok.Pos.Offset != 5 {
+		t.Errorf("Expected x at column 5, offset 5, got %d, %d instead\n", tok.Pos.Column, tok.Pos.Offset)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "${y}"} } c" "$5 \${z}"`
+
+	cases := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_HEAD, "a "},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_MIDDLE, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.TEMPLATE_TAIL, " c"},
+		{token.STRING, "$5 ${z}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for _, tc := range cases {
+		tok := l.NextToken()
+		if tok.Type != tc.expectedType {
+			t.Fatalf("Expected TokenType %q, got %q instead\n", tc.expectedType, tok.Type)
+		}
+		if tok.Literal != tc.expectedLiteral {
+			t.Fatalf("Expected Literal %q, got %q instead\n", tc.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = "abc`, []string{"1:9: unterminated string literal"}},
+		{`"a\q" "b\`, []string{"1:3: invalid escape sequence \\q", "1:7: unterminated string literal"}},
+		{"1 /* 2\n3", []string{"1:3: unterminated block comment"}},
+		{"a & b | c $", []string{"1:3: invalid character '&'", "1:7: invalid character '|'", "1:11: invalid character '$'"}},
+		{"\xff", []string{"1:1: invalid UTF-8 encoding"}},
+		{`"ok" /* ok */ a && b`, []string{}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("Expected %d errors for %q, got %d instead: %v\n", len(tt.expected), tt.input, len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i].Error() != msg {
+				t.Errorf("Expected error %q, got %q instead\n", msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 0.5 12.25 1e3 1E-3 2.5e+10 7e x 3.`
+
+	cases := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "12.25"},
+		{token.FLOAT, "1e3"},
+		{token.FLOAT, "1E-3"},
+		{token.FLOAT, "2.5e+10"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.INT, "3"},
+		{token.ILLEGAL, "."},
 		{token.EOF, ""},
 	}
 
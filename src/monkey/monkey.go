@@ -0,0 +1,292 @@
+// Package monkey embeds the Monkey programming language in Go programs
+//
+//	interp := monkey.New(monkey.Options{})
+//	interp.Register("double", func(args ...object.Object) (object.Object, error) {
+//		n, ok := args[0].(*object.Integer)
+//		if !ok {
+//			return nil, fmt.Errorf("expected INTEGER, got %s instead", args[0].Type())
+//		}
+//		return &object.Integer{Value: 2 * n.Value}, nil
+//	})
+//	value, err := interp.Eval("double(21)")
+package monkey
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/compiler"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/evaluator"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/vm"
+)
+
+// backend executing the programs
+type Engine string
+
+const (
+	ENGINE_EVAL Engine = "eval" // tree-walking evaluator
+	ENGINE_VM   Engine = "vm"   // bytecode compiler and virtual machine
+)
+
+type Options struct {
+	Engine Engine    // ENGINE_EVAL if empty
+	Stdout io.Writer // output of puts, os.Stdout if nil
+
+	// limits of each execution, except MaxMemory which bounds all of them
+	// together until Interpreter.ResetMemory
+	Limits object.Limits
+}
+
+// Interpreter runs programs in global bindings persisting between the
+// calls, it must not be used by several goroutines at once
+type Interpreter struct {
+	engine  Engine
+	runtime *object.Runtime
+
+	env *object.Environment // ENGINE_EVAL
+
+	symbolTable *compiler.SymbolTable // ENGINE_VM
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func New(options Options) *Interpreter {
+	i := &Interpreter{
+		engine:  options.Engine,
+		runtime: &object.Runtime{Stdout: options.Stdout, Limits: options.Limits},
+	}
+	if i.engine == "" {
+		i.engine = ENGINE_EVAL
+	}
+	if i.runtime.Stdout == nil {
+		i.runtime.Stdout = os.Stdout
+	}
+
+	if i.engine == ENGINE_VM {
+		i.symbolTable = compiler.NewSymbolTable()
+		for index, v := range object.Builtins {
+			i.symbolTable.DefineBuiltin(index, v.Name)
+		}
+		i.constants = []object.Object{}
+		i.globals = vm.NewGlobalsStore()
+	} else {
+		i.env = object.NewEnvironment()
+		i.env.SetRuntime(i.runtime)
+	}
+	return i
+}
+
+// SyntaxError reports the diagnostics of a program which can't be parsed
+type SyntaxError struct {
+	Diagnostics []parser.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := []string{}
+	for _, d := range e.Diagnostics {
+		messages = append(messages, d.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// RuntimeError is an error object raised by a program, its Stack has the
+// calls it propagated out of with ENGINE_EVAL
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Message
+}
+
+// Eval runs src, see Run
+func (i *Interpreter) Eval(src string) (object.Object, error) {
+	return i.EvalContext(context.Background(), src)
+}
+
+// EvalContext runs src until ctx is done, see RunContext
+func (i *Interpreter) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, &SyntaxError{Diagnostics: p.Diagnostics()}
+	}
+	return i.RunContext(ctx, program)
+}
+
+// Run runs program and returns the value of its last statement, nil if the
+// statement doesn't produce one like let. The errors are *RuntimeError
+func (i *Interpreter) Run(program *ast.Program) (object.Object, error) {
+	return i.RunContext(context.Background(), program)
+}
+
+// RunContext runs program as Run, stopping with an error when ctx is done
+// or the limits of the interpreter are exceeded
+func (i *Interpreter) RunContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	defer i.runtime.Begin(ctx)()
+
+	var result object.Object
+
+	if i.engine == ENGINE_VM {
+		// the names defined by a program which fails to compile are dropped,
+		// their globals would never be set
+		symbolTable := i.symbolTable.Copy()
+		comp := compiler.NewWithState(symbolTable, i.constants)
+		if err := comp.Compile(program); err != nil {
+			return nil, runtimeError(err)
+		}
+		bytecode := comp.Bytecode()
+		i.symbolTable = symbolTable
+		i.constants = bytecode.Constants
+
+		machine := vm.NewWithGlobalsState(bytecode, i.globals)
+		machine.SetRuntime(i.runtime)
+		if err := machine.Run(); err != nil {
+			return nil, runtimeError(err)
+		}
+		result = machine.LastPoppedStackElem()
+	} else {
+		result = evaluator.Eval(program, i.env)
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, &RuntimeError{Err: errObj}
+		}
+	}
+
+	if !hasValue(program) {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// Call calls the function bound to name, or the builtin, with args
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls the function as Call, stopping with an error when ctx
+// is done or the limits of the interpreter are exceeded
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	defer i.runtime.Begin(ctx)()
+
+	fn, ok := i.Get(name)
+	if builtin := object.GetBuiltinByName(name); !ok && builtin != nil {
+		fn, ok = builtin, true
+	}
+	if !ok {
+		return nil, &RuntimeError{Err: &object.Error{Message: "identifier not found: " + name}}
+	}
+
+	if i.engine == ENGINE_VM {
+		machine := vm.NewWithGlobalsState(&compiler.Bytecode{Constants: i.constants}, i.globals)
+		machine.SetRuntime(i.runtime)
+		result, err := machine.Call(fn, args...)
+		if err != nil {
+			return nil, runtimeError(err)
+		}
+		return result, nil
+	}
+
+	result := evaluator.Call(fn, args, i.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+	return result, nil
+}
+
+// Get returns the value of the global name
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	if i.engine == ENGINE_VM {
+		symbol, ok := i.symbolTable.Resolve(name)
+		if !ok || symbol.Scope != compiler.GlobalScope || i.globals[symbol.Index] == nil {
+			return nil, false
+		}
+		return i.globals[symbol.Index], true
+	}
+	return i.env.Get(name)
+}
+
+// Set binds the global name to value
+func (i *Interpreter) Set(name string, value object.Object) {
+	if i.engine == ENGINE_VM {
+		symbol := i.symbolTable.Define(name)
+		i.globals[symbol.Index] = value
+		return
+	}
+	i.env.Set(name, value)
+}
+
+// Names returns the names of the globals sorted
+func (i *Interpreter) Names() []string {
+	if i.engine != ENGINE_VM {
+		return i.env.Names()
+	}
+
+	names := []string{}
+	for _, symbol := range i.symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope && i.globals[symbol.Index] != nil {
+			names = append(names, symbol.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function is a Go function callable by the programs, a nil result is null
+// and an error is raised as an error object
+type Function func(args ...object.Object) (object.Object, error)
+
+// Register binds the global name to fn, in this interpreter only
+func (i *Interpreter) Register(name string, fn Function) {
+	i.Set(name, &object.Builtin{Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+		result, err := fn(args...)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}})
+}
+
+// SetLimits sets the limits of the following executions
+func (i *Interpreter) SetLimits(limits object.Limits) {
+	i.runtime.Limits = limits
+}
+
+// ResetMemory resets the memory counted against Limits.MaxMemory, e.g. after
+// replacing the globals holding the values of the previous executions
+func (i *Interpreter) ResetMemory() {
+	i.runtime.ResetMemory()
+}
+
+// SetStdout sets the output of puts
+func (i *Interpreter) SetStdout(w io.Writer) {
+	i.runtime.Stdout = w
+}
+
+func runtimeError(err error) *RuntimeError {
+	var errObj *object.Error
+	if errors.As(err, &errObj) {
+		return &RuntimeError{Err: errObj}
+	}
+	return &RuntimeError{Err: &object.Error{Message: err.Error()}}
+}
+
+// whether the last statement of program produces a value
+func hasValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,290 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+)
+
+var engines = []Engine{ENGINE_EVAL, ENGINE_VM}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Inspect of the value, "" for no value
+		err      string
+	}{
+		{"1 + 2", "3", ""},
+		{"let x = 5;", "", ""},
+		{"let x = 5; x * 2", "10", ""},
+		{"\"a\" + \"b\"", "ab", ""},
+		{"1 + true", "", "type mismatch: INTEGER + BOOLEAN"},
+		{"let = 1", "", "1:5: expected next token to be IDENT, got = instead"},
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER", ""},
+		{`throw "boom"`, "", "boom"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			interp := New(Options{Engine: engine})
+			value, err := interp.Eval(tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("%s: expected error %q for %q, got %v instead", engine, tt.err, tt.input, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error for %q: %s", engine, tt.input, err)
+				continue
+			}
+			inspected := ""
+			if value != nil {
+				inspected = value.Inspect()
+			}
+			if inspected != tt.expected {
+				t.Errorf("%s: expected %q for %q, got %q instead", engine, tt.expected, tt.input, inspected)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, engine := range engines {
+		interp := New(Options{Engine: engine})
+
+		_, err := interp.Eval("let")
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || len(syntaxErr.Diagnostics) == 0 {
+			t.Errorf("%s: expected *SyntaxError, got %T (%v) instead", engine, err, err)
+		}
+
+		_, err = interp.Eval("-true")
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Err.Message != "unknown operator: -BOOLEAN" {
+			t.Errorf("%s: expected *RuntimeError, got %T (%v) instead", engine, err, err)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	for _, engine := range engines {
+		interp := New(Options{Engine: engine})
+
+		if _, ok := interp.Get("x"); ok {
+			t.Errorf("%s: expected x to be unbound", engine)
+		}
+
+		interp.Set("x", &object.Integer{Value: 20})
+		value, err := interp.Eval("let y = x + 1; y")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 21)
+
+		value, ok := interp.Get("y")
+		if !ok {
+			t.Fatalf("%s: expected y to be bound", engine)
+		}
+		testInteger(t, engine, value, 21)
+
+		names := fmt.Sprint(interp.Names())
+		if names != "[x y]" {
+			t.Errorf("%s: expected names [x y], got %s instead", engine, names)
+		}
+
+		// the names of a failed program are either bound or unknown, never
+		// defined without a value
+		interp.Eval("let a = 1; let b = nope;")
+		interp.Eval("let f = fn() { nope };")
+		for _, name := range []string{"a", "b", "f"} {
+			_, bound := interp.Get(name)
+			_, err := interp.Eval(name)
+			if bound && err != nil {
+				t.Errorf("%s: unexpected error for bound %s: %s", engine, name, err)
+			}
+			if !bound && (err == nil || err.Error() != "identifier not found: "+name) {
+				t.Errorf("%s: expected identifier not found error for %s, got %v instead", engine, name, err)
+			}
+		}
+		value, err = interp.Eval("let a = 2; a")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 2)
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, engine := range engines {
+		interp := New(Options{Engine: engine})
+		_, err := interp.Eval(`
+let offset = 10;
+let add = fn(a, b) { a + b + offset };
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+
+		value, err := interp.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 13)
+
+		value, err = interp.Call("fib", &object.Integer{Value: 10})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 55)
+
+		value, err = interp.Call("len", &object.String{Value: "abc"})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 3)
+
+		_, err = interp.Call("add", &object.Integer{Value: 1})
+		if err == nil || err.Error() != "wrong number of arguments: want=2, got=1" {
+			t.Errorf("%s: expected wrong number of arguments error, got %v instead", engine, err)
+		}
+
+		_, err = interp.Call("missing")
+		if err == nil || err.Error() != "identifier not found: missing" {
+			t.Errorf("%s: expected identifier not found error, got %v instead", engine, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	for _, engine := range engines {
+		var out bytes.Buffer
+		interp := New(Options{Engine: engine, Stdout: &out})
+		interp.Register("double", func(args ...object.Object) (object.Object, error) {
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return nil, fmt.Errorf("expected INTEGER, got %s instead", args[0].Type())
+			}
+			return &object.Integer{Value: 2 * n.Value}, nil
+		})
+
+		value, err := interp.Eval("puts(double(4)); let f = fn(x) { double(x) + 1 }; f(10)")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testInteger(t, engine, value, 21)
+		if out.String() != "8\n" {
+			t.Errorf("%s: expected output %q, got %q instead", engine, "8\n", out.String())
+		}
+
+		_, err = interp.Eval("double(true)")
+		if err == nil || err.Error() != "expected INTEGER, got BOOLEAN instead" {
+			t.Errorf("%s: expected the error of double, got %v instead", engine, err)
+		}
+
+		// the functions are registered per interpreter
+		_, err = New(Options{Engine: engine}).Eval("double(1)")
+		if err == nil || err.Error() != "identifier not found: double" {
+			t.Errorf("%s: expected double to be unbound in another interpreter, got %v instead", engine, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		interp := New(Options{Engine: engine, Limits: object.Limits{MaxDepth: 100, MaxSteps: 10000}})
+
+		for _, input := range []string{"let f = fn(x) { f(x) }; f(1)", "let f = fn(x) { 1 + f(x) }; f(1)"} {
+			_, err := interp.Eval(input)
+			if err == nil || err.Error() != "maximum recursion depth exceeded" {
+				t.Errorf("%s: expected maximum recursion depth exceeded, got %v instead", engine, err)
+			}
+		}
+
+		// the steps are counted per execution
+		for n := 0; n < 3; n++ {
+			if _, err := interp.Eval("let i = 0; while (i < 100) { i += 1 }"); err != nil {
+				t.Errorf("%s: unexpected error: %s", engine, err)
+			}
+		}
+		_, err := interp.Eval("while (true) { }")
+		if err == nil || err.Error() != "maximum number of steps exceeded" {
+			t.Errorf("%s: expected maximum number of steps exceeded, got %v instead", engine, err)
+		}
+
+		if _, err := interp.Eval("let loop = fn() { while (true) { } };"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		interp.SetLimits(object.Limits{})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = interp.CallContext(ctx, "loop")
+		cancel()
+		if err == nil || err.Error() != "execution timed out" {
+			t.Errorf("%s: expected execution timed out, got %v instead", engine, err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = interp.EvalContext(ctx, "loop()")
+		if err == nil || err.Error() != "execution cancelled" {
+			t.Errorf("%s: expected execution cancelled, got %v instead", engine, err)
+		}
+	}
+}
+
+func TestMemoryQuota(t *testing.T) {
+	for _, engine := range engines {
+		interp := New(Options{Engine: engine, Limits: object.Limits{MaxMemory: 1 << 20}})
+
+		_, err := interp.Eval("let s = \"x\"; while (true) { s = s + s }")
+		if err == nil || err.Error() != "memory quota exceeded" {
+			t.Errorf("%s: expected memory quota exceeded, got %v instead", engine, err)
+		}
+
+		// the allocations add up over the executions, each of which fits
+		interp = New(Options{Engine: engine, Limits: object.Limits{MaxMemory: 1 << 20}})
+		if _, err := interp.Eval("let a = [];"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		n := 0
+		for ; n < 100; n++ {
+			_, err = interp.Eval("let i = 0; while (i < 100) { a = push(a, i); i += 1 }; a = []")
+			if err != nil {
+				break
+			}
+		}
+		if err == nil || err.Error() != "memory quota exceeded" || n == 0 {
+			t.Errorf("%s: expected memory quota exceeded after a few executions, got %v after %d instead", engine, err, n)
+		}
+
+		// until the count is reset
+		interp.ResetMemory()
+		if _, err := interp.Eval("let i = 0; while (i < 100) { a = push(a, i); i += 1 }; a = []"); err != nil {
+			t.Errorf("%s: unexpected error after ResetMemory: %s", engine, err)
+		}
+
+		// another interpreter has its own quota
+		other := New(Options{Engine: engine})
+		if _, err := other.Eval("let s = \"x\"; let i = 0; while (i < 20) { s = s + s; i += 1 }; len(s)"); err != nil {
+			t.Errorf("%s: unexpected error: %s", engine, err)
+		}
+	}
+}
+
+func testInteger(t *testing.T, engine Engine, obj object.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("%s: expected *object.Integer, got %T (%+v) instead", engine, obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("%s: expected %d, got %d instead", engine, expected, result.Value)
+	}
+}
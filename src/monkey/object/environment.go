@@ -1,19 +1,32 @@
 package object
 
+import "sort"
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store   map[string]Object
+	outer   *Environment
+	runtime *Runtime
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, runtime: NewRuntime()}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, runtime: outer.runtime}
+}
+
+// Runtime returns the runtime of the evaluation in e, a new one for every
+// environment created with NewEnvironment unless set with SetRuntime
+func (e *Environment) Runtime() *Runtime {
+	return e.runtime
+}
+
+// SetRuntime sets the runtime of the environments created from e afterwards
+func (e *Environment) SetRuntime(rt *Runtime) {
+	e.runtime = rt
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,3 +41,27 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Names returns the names bound in e itself, not in its outer environments,
+// sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Assign rebinds name in the innermost environment which defines it, it
+// reports false when name isn't defined at all
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
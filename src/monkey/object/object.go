@@ -3,22 +3,36 @@ package object
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/code"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
 )
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
 )
 
 type ObjectType string
@@ -32,6 +46,11 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// objects which can be looped over with for (x in <iterable>)
+type Iterable interface {
+	Items() []Object
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -57,7 +76,49 @@ func (h *Hash) Inspect() string {
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
 
-type BuiltinFunction func(args ...Object) Object
+// keys in a stable order: numbers by value, then booleans and strings
+func (h *Hash) Items() []Object {
+	keys := make([]Object, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+	return keys
+}
+
+func lessKey(a, b Object) bool {
+	rank := func(o Object) int {
+		switch o.(type) {
+		case *Integer, *Float:
+			return 0
+		case *Boolean:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+		return float64(a.Value) < b.(*Float).Value
+	case *Float:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < float64(b.Value)
+		}
+		return a.Value < b.(*Float).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+type BuiltinFunction func(rt *Runtime, args ...Object) Object
 
 type Integer struct {
 	Value int64
@@ -73,6 +134,32 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// shortest representation which reads back to the same value, always
+// distinguishable from an integer: 1.0, 0.5, 1e-07
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// integral floats share the key of the equal integer, as 1.0 == 1
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && math.Abs(f.Value) < 1<<63 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -112,6 +199,34 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// length in characters (code points), not bytes
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// the character at index i, counted in code points
+func (s *String) CharAt(i int64) (*String, bool) {
+	if i < 0 {
+		return nil, false
+	}
+	for _, ch := range s.Value {
+		if i == 0 {
+			return &String{Value: string(ch)}, true
+		}
+		i -= 1
+	}
+	return nil, false
+}
+
+// one string per character
+func (s *String) Items() []Object {
+	items := []Object{}
+	for _, ch := range s.Value {
+		items = append(items, &String{Value: string(ch)})
+	}
+	return items
+}
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType {
@@ -132,10 +247,46 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// signals leaving the innermost loop, threaded through blocks like ReturnValue
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// a call in tail position of a function body, returned by the function and
+// applied by its caller so that tail recursion doesn't nest
+type TailCall struct {
+	Fn   Object
+	Args []Object
+	Node *ast.CallExpression // for the stack of an error raised by the call
+}
+
+func (tc *TailCall) Type() ObjectType {
+	return TAIL_CALL_OBJ
+}
+func (tc *TailCall) Inspect() string {
+	return "tail call"
+}
+
+// signals skipping to the next iteration of the innermost loop
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // name of the binding if the function is bound by let
 }
 
 func (f *Function) Type() ObjectType {
@@ -164,6 +315,11 @@ func (b *Builtin) Inspect() string {
 
 type Error struct {
 	Message string
+	Stack   []Frame // calls the error propagated out of, innermost first
+
+	// set when a limit of the runtime is exceeded, the error can't be
+	// caught and stops the execution
+	Fatal bool
 }
 
 func (e *Error) Type() ObjectType {
@@ -173,6 +329,101 @@ func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
+// Error returns the message, so that an error object can be returned as a
+// Go error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// FatalError returns the error object of err, a limit of the runtime being
+// exceeded
+func FatalError(err error) *Error {
+	return &Error{Message: err.Error(), Fatal: true}
+}
+
+// Throw returns the error thrown by `throw value`. An error value is thrown
+// again with its stack, a string becomes the message of a new error
+func Throw(value Object) *Error {
+	switch value := value.(type) {
+	case *ErrorValue:
+		stack := make([]Frame, len(value.Err.Stack))
+		copy(stack, value.Err.Stack)
+		return &Error{Message: value.Err.Message, Stack: stack}
+	case *String:
+		return &Error{Message: value.Value}
+	default:
+		return &Error{Message: value.Inspect()}
+	}
+}
+
+// calls shown at both ends of a longer traceback
+const TRACEBACK_FRAMES = 10
+
+// Traceback returns Inspect followed by the calls of the stack, the middle
+// of a deep stack is elided
+//
+//	ERROR: type mismatch: INTEGER + STRING
+//	  at add (main.mk:2:14)
+//	  at main.mk:5:1
+func (e *Error) Traceback() string {
+	var out strings.Builder
+	out.WriteString(e.Inspect())
+
+	for i, frame := range e.Stack {
+		if n := len(e.Stack); n > 2*TRACEBACK_FRAMES && i >= TRACEBACK_FRAMES && i < n-TRACEBACK_FRAMES {
+			if i == TRACEBACK_FRAMES {
+				fmt.Fprintf(&out, "\n  ... %d more calls", n-2*TRACEBACK_FRAMES)
+			}
+			continue
+		}
+		out.WriteString("\n  at " + frame.String())
+	}
+	return out.String()
+}
+
+// a call in the stack of an error
+type Frame struct {
+	Function string         // name of the function called, "" if it has none
+	Pos, End token.Position // of the call expression
+}
+
+// function (position of the call), or the position alone
+func (f Frame) String() string {
+	if f.Function == "" {
+		return f.Pos.String()
+	}
+	return fmt.Sprintf("%s (%s)", f.Function, f.Pos)
+}
+
+// ErrorValue is a caught error, bound to the parameter of a catch clause
+type ErrorValue struct {
+	Err *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType {
+	return ERROR_VALUE_OBJ
+}
+func (ev *ErrorValue) Inspect() string {
+	return fmt.Sprintf("error(%q)", ev.Err.Message)
+}
+
+// Field returns e["message"] or e["stack"], the calls of the stack as
+// strings innermost first
+func (ev *ErrorValue) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ev.Err.Message}, true
+	case "stack":
+		frames := make([]Object, len(ev.Err.Stack))
+		for i, frame := range ev.Err.Stack {
+			frames[i] = &String{Value: frame.String()}
+		}
+		return &Array{Elements: frames}, true
+	default:
+		return nil, false
+	}
+}
+
 type Array struct {
 	Elements []Object
 }
@@ -187,3 +438,34 @@ func (ao *Array) Inspect() string {
 	}
 	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
 }
+func (ao *Array) Items() []Object {
+	items := make([]Object, len(ao.Elements))
+	copy(items, ao.Elements)
+	return items
+}
+
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// a compiled function together with the free variables it closes over
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return CLOSURE_OBJ
+}
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -1,6 +1,42 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
+)
+
+func TestErrorTraceback(t *testing.T) {
+	frame := func(name string, line int) Frame {
+		return Frame{Function: name, Pos: token.Position{Filename: "a.mk", Line: line, Column: 3}}
+	}
+
+	err := &Error{Message: "boom", Stack: []Frame{frame("f", 2), frame("", 7)}}
+	expected := "ERROR: boom\n  at f (a.mk:2:3)\n  at a.mk:7:3"
+	if err.Traceback() != expected {
+		t.Errorf("expected traceback %q, got %q instead", expected, err.Traceback())
+	}
+
+	err = &Error{Message: "deep"}
+	for i := 0; i < 2*TRACEBACK_FRAMES+5; i++ {
+		err.Stack = append(err.Stack, frame("f", i+1))
+	}
+	lines := strings.Split(err.Traceback(), "\n")
+	if len(lines) != 2*TRACEBACK_FRAMES+2 {
+		t.Fatalf("expected %d lines, got %d instead", 2*TRACEBACK_FRAMES+2, len(lines))
+	}
+	elided := "  ... 5 more calls"
+	if lines[TRACEBACK_FRAMES+1] != elided {
+		t.Errorf("expected %q, got %q instead", elided, lines[TRACEBACK_FRAMES+1])
+	}
+	last := fmt.Sprintf("  at f (a.mk:%d:3)", 2*TRACEBACK_FRAMES+5)
+	if lines[len(lines)-1] != last {
+		t.Errorf("expected %q, got %q instead", last, lines[len(lines)-1])
+	}
+}
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -22,3 +58,70 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with same content have different hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	half1 := &Float{Value: 0.5}
+	half2 := &Float{Value: 0.5}
+	one := &Float{Value: 1.0}
+	negativeZero := &Float{Value: math.Copysign(0, -1)}
+
+	if half1.HashKey() != half2.HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if half1.HashKey() == one.HashKey() {
+		t.Errorf("floats with different value have same hash keys")
+	}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integral float has different hash key than the equal integer")
+	}
+	if negativeZero.HashKey() != (&Float{Value: 0}).HashKey() {
+		t.Errorf("-0.0 and 0.0 have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0.5, "0.5"},
+		{1, "1.0"},
+		{-2, "-2.0"},
+		{1e-7, "1e-07"},
+		{1e21, "1e+21"},
+		{123456.75, "123456.75"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for %v. want=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestHashItems(t *testing.T) {
+	keys := []Object{
+		&String{Value: "b"},
+		&Boolean{Value: true},
+		&Integer{Value: 2},
+		&String{Value: "a"},
+		&Float{Value: 1.5},
+		&Boolean{Value: false},
+	}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, k := range keys {
+		hash.Pairs[k.(Hashable).HashKey()] = HashPair{Key: k, Value: &Null{}}
+	}
+
+	expected := []string{"1.5", "2", "false", "true", "a", "b"}
+	items := hash.Items()
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d items, got %d instead", len(expected), len(items))
+	}
+	for i, item := range items {
+		if item.Inspect() != expected[i] {
+			t.Errorf("expected item %d to be %s, got %s instead", i, expected[i], item.Inspect())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// nested function calls allowed when Limits.MaxDepth is 0, low enough for
+// the evaluator not to overflow the Go stack
+const DEFAULT_MAX_DEPTH = 10000
+
+// the context of an execution is checked every this many steps
+const CONTEXT_CHECK_INTERVAL = 64
+
+// approximate sizes in bytes of the values counted by Allocate
+const (
+	OBJECT_SIZE    = 16 // a string, an array or a hash without its content
+	ELEMENT_SIZE   = 16 // an element of an array
+	HASH_PAIR_SIZE = 48 // a pair of a hash
+)
+
+var (
+	ErrMaxDepth  = errors.New("maximum recursion depth exceeded")
+	ErrMaxSteps  = errors.New("maximum number of steps exceeded")
+	ErrCancelled = errors.New("execution cancelled")
+	ErrTimeout   = errors.New("execution timed out")
+	ErrMaxMemory = errors.New("memory quota exceeded")
+)
+
+// Limits bounds the resources used by an execution, a zero field is
+// unlimited unless stated otherwise
+type Limits struct {
+	MaxDepth int           // nested function calls, tail calls included, DEFAULT_MAX_DEPTH if 0
+	MaxSteps int64         // nodes evaluated or instructions executed
+	Timeout  time.Duration // wall-clock time
+
+	// approximate bytes of the strings, arrays and hashes created by all the
+	// executions of the runtime, whether they are still used or not. The
+	// count is only reset by ResetMemory, so that a long-lived interpreter
+	// fed with many inputs can't outgrow the quota either
+	MaxMemory int64
+}
+
+// Runtime is the state of the host running an evaluation, shared with the
+// builtins it calls. It counts the steps and the depth of the execution so
+// it can't be used by two executions at once, and the memory allocated by
+// all of them
+type Runtime struct {
+	Stdout io.Writer // output of puts
+	Limits Limits
+
+	ctx       context.Context
+	steps     int64
+	depth     int
+	allocated int64
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{Stdout: os.Stdout}
+}
+
+// Begin starts an execution which stops when ctx is done or the limits are
+// exceeded, the returned function must be called when it ends
+func (rt *Runtime) Begin(ctx context.Context) (end func()) {
+	cancel := func() {}
+	if rt.Limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, rt.Limits.Timeout)
+	}
+	rt.ctx = ctx
+	rt.steps = 0
+	rt.depth = 0
+
+	return func() {
+		cancel()
+		rt.ctx = nil
+	}
+}
+
+// Step counts a step of the execution, it returns an error when the
+// execution must stop
+func (rt *Runtime) Step() error {
+	rt.steps += 1
+	if rt.Limits.MaxSteps > 0 && rt.steps > rt.Limits.MaxSteps {
+		return ErrMaxSteps
+	}
+	if rt.ctx != nil && rt.steps%CONTEXT_CHECK_INTERVAL == 0 {
+		return rt.Err()
+	}
+	return nil
+}
+
+// Err returns the reason of the execution being stopped by its context, if
+// it is
+func (rt *Runtime) Err() error {
+	if rt.ctx == nil {
+		return nil
+	}
+	switch rt.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	default:
+		return ErrCancelled
+	}
+}
+
+// Enter counts a function call, to be matched by Leave when it returns
+func (rt *Runtime) Enter() error {
+	if rt.depth >= rt.MaxDepth() {
+		return ErrMaxDepth
+	}
+	rt.depth += 1
+	return nil
+}
+
+func (rt *Runtime) Leave() {
+	rt.depth -= 1
+}
+
+// Allocate counts size bytes allocated by the runtime, it returns an error
+// when the quota would be exceeded. The size is counted before allocating so
+// that a huge value is never created, a refused allocation isn't counted
+func (rt *Runtime) Allocate(size int64) error {
+	if rt.Limits.MaxMemory > 0 && rt.allocated+size > rt.Limits.MaxMemory {
+		return ErrMaxMemory
+	}
+	rt.allocated += size
+	return nil
+}
+
+// ResetMemory forgets the memory allocated so far, once the values created
+// by the previous executions are no longer used
+func (rt *Runtime) ResetMemory() {
+	rt.allocated = 0
+}
+
+// StringSize returns the approximate size of a string of n bytes
+func StringSize(n int) int64 {
+	return OBJECT_SIZE + int64(n)
+}
+
+// ArraySize returns the approximate size of an array of n elements
+func ArraySize(n int) int64 {
+	return OBJECT_SIZE + int64(n)*ELEMENT_SIZE
+}
+
+// HashSize returns the approximate size of a hash of n pairs
+func HashSize(n int) int64 {
+	return OBJECT_SIZE + int64(n)*HASH_PAIR_SIZE
+}
+
+// IsFatal reports whether err stops the execution whatever the try
+// expressions it is in, which is the case of the limits being exceeded
+func IsFatal(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Fatal
+	}
+	return errors.Is(err, ErrMaxDepth) || errors.Is(err, ErrMaxSteps) ||
+		errors.Is(err, ErrCancelled) || errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrMaxMemory)
+}
+
+// MaxDepth returns the maximum number of nested function calls
+func (rt *Runtime) MaxDepth() int {
+	if rt.Limits.MaxDepth > 0 {
+		return rt.Limits.MaxDepth
+	}
+	return DEFAULT_MAX_DEPTH
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
+)
+
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ERROR:
+		return "error"
+	case WARNING:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// stable identifiers of diagnostics, safe to match on in tooling
+type Code string
+
+const (
+	UNEXPECTED_TOKEN Code = "unexpected-token"
+	NO_PREFIX_PARSE  Code = "no-prefix-parse-fn"
+	INVALID_INTEGER  Code = "invalid-integer"
+	INVALID_FLOAT    Code = "invalid-float"
+	OUTSIDE_LOOP     Code = "outside-loop"
+	INVALID_TARGET   Code = "invalid-assignment-target"
+
+	// reported by the lexer
+	UNTERMINATED_STRING  Code = lexer.UNTERMINATED_STRING
+	UNTERMINATED_COMMENT Code = lexer.UNTERMINATED_COMMENT
+	INVALID_CHARACTER    Code = lexer.INVALID_CHARACTER
+	INVALID_ESCAPE       Code = lexer.INVALID_ESCAPE
+)
+
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position // start of the offending source
+	End      token.Position // end of the offending source
+	Code     Code
+	Message  string
+	Expected []token.TokenType // token types that would have been accepted, if any
+	Actual   token.TokenType   // token type that was found
+	Hint     string            // optional suggestion to fix the problem
+}
+
+// <position>: <message>
+func (d Diagnostic) String() string {
+	if !d.Pos.IsValid() {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Excerpt renders the diagnostic with the offending line of src underlined
+//
+//	1:11: error: expected next token to be ), got ; instead
+//	  let x = (1;
+//	            ^
+func (d Diagnostic) Excerpt(src string) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s: %s: %s\n", d.Pos, d.Severity, d.Message)
+
+	line, ok := sourceLine(src, d.Pos.Line)
+	if ok {
+		out.WriteString("  " + line + "\n")
+		out.WriteString("  " + underline(line, d.Pos, d.End) + "\n")
+	}
+	if d.Hint != "" {
+		out.WriteString("  hint: " + d.Hint + "\n")
+	}
+
+	return out.String()
+}
+
+func sourceLine(src string, n int) (string, bool) {
+	if n < 1 {
+		return "", false
+	}
+	lines := strings.Split(src, "\n")
+	if n > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// carets below [pos, end) of line, keeping tabs so the carets line up
+func underline(line string, pos, end token.Position) string {
+	chars := []rune(line) // columns count characters, not bytes
+	start := pos.Column - 1
+	if start > len(chars) {
+		start = len(chars)
+	}
+	width := 1
+	if end.Line == pos.Line && end.Column > pos.Column {
+		width = end.Column - pos.Column
+	}
+
+	var out strings.Builder
+	for i := 0; i < start; i++ {
+		if chars[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
@@ -13,8 +14,11 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN       // = or +=
+	LOGICAL_OR   // ||
+	LOGICAL_AND  // &&
 	EQUALS       // ==
-	LESS_GREATER // > or <
+	LESS_GREATER // > or <, >= or <=
 	SUM          // +
 	PRODUCT      // *
 	PREFIX       // -X or !X
@@ -23,16 +27,27 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESS_GREATER,
-	token.GT:       LESS_GREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESS_GREATER,
+	token.GT:              LESS_GREATER,
+	token.LT_EQ:           LESS_GREATER,
+	token.GT_EQ:           LESS_GREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -42,9 +57,22 @@ type (
 
 type Parser struct {
 	l         *lexer.Lexer
+	prevToken token.Token
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	pending   []token.Token // tokens pushed back by backup()
+	errors    []Diagnostic
+	lexErrors int            // number of lexer errors copied to errors
+	comments  []*ast.Comment // comments read so far, if the lexer scans them
+
+	// set on the first error in a statement, suppresses follow-on errors
+	// until the parser has synchronized to the next statement boundary
+	panicking bool
+	stmtStart token.Token
+	stmtDepth int
+	depth     int // number of open braces up to curToken
+
+	loopDepth int // number of loops enclosing curToken in the current function
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -53,20 +81,23 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:              l,
-		errors:         []string{},
+		errors:         []Diagnostic{},
 		prefixParseFns: make(map[token.TokenType]prefixParseFn),
 		infixParseFns:  make(map[token.TokenType]infixParseFn),
 	}
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
@@ -78,8 +109,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 
 	// read to token to setup curToken and peekToken
 	p.nextToken()
@@ -88,14 +130,52 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Errors renders the diagnostics as "<position>: <message>" strings
 func (p *Parser) Errors() []string {
+	errors := make([]string, 0, len(p.errors))
+	for _, d := range p.errors {
+		errors = append(errors, d.String())
+	}
+	return errors
+}
+
+func (p *Parser) Diagnostics() []Diagnostic {
 	return p.errors
 }
 
+func (p *Parser) errorAt(tok token.Token, code Code, msg string) *Diagnostic {
+	if p.panicking {
+		return &Diagnostic{}
+	}
+	p.panicking = true
+	if tok.Type == token.ILLEGAL {
+		// already reported by the lexer
+		return &Diagnostic{}
+	}
+
+	p.errors = append(p.errors, Diagnostic{
+		Severity: ERROR,
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Code:     code,
+		Message:  msg,
+		Actual:   tok.Type,
+	})
+	d := &p.errors[len(p.errors)-1]
+	if tok.Type == token.EOF {
+		d.Hint = "the input ended before the statement was complete"
+	}
+	return d
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.expectError(p.peekToken, t)
+}
 
+func (p *Parser) expectError(tok token.Token, t token.TokenType) {
+	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, tok.Type)
+	d := p.errorAt(tok, UNEXPECTED_TOKEN, msg)
+	d.Expected = []token.TokenType{t}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -109,13 +189,101 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
+
+	// lexical errors are reported as soon as the lexer reads ahead
+	sort.SliceStable(p.errors, func(i, j int) bool {
+		return p.errors[i].Pos.Offset < p.errors[j].Pos.Offset
+	})
 
 	return program
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if len(p.pending) > 0 {
+		p.peekToken = p.pending[len(p.pending)-1]
+		p.pending = p.pending[:len(p.pending)-1]
+	} else {
+		p.peekToken = p.readToken()
+	}
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth += 1
+	case token.RBRACE:
+		p.depth -= 1
+	}
+}
+
+// next token of the lexer, collecting the comments and lexical errors on
+// the way
+func (p *Parser) readToken() token.Token {
+	tok := p.l.NextToken()
+	for tok.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: tok, Text: tok.Literal})
+		tok = p.l.NextToken()
+	}
+
+	errors := p.l.Errors()
+	for _, e := range errors[p.lexErrors:] {
+		p.errors = append(p.errors, Diagnostic{
+			Severity: ERROR,
+			Pos:      e.Pos,
+			End:      e.End,
+			Code:     Code(e.Code),
+			Message:  e.Msg,
+			Actual:   token.ILLEGAL,
+		})
+	}
+	p.lexErrors = len(errors)
+
+	return tok
+}
+
+// step back one token, only valid once after nextToken()
+func (p *Parser) backup() {
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth -= 1
+	case token.RBRACE:
+		p.depth += 1
+	}
+
+	p.pending = append(p.pending, p.peekToken)
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
+}
+
+// skip tokens up to the end of the current statement, leaving curToken on
+// its last token so that the next call of nextToken() starts a new statement
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.EOF) && p.depth >= p.stmtDepth {
+		if p.depth == p.stmtDepth {
+			if p.curTokenIs(token.SEMICOLON) {
+				break
+			}
+			// end of a block which isn't continued by `else`, `catch`, `finally`,
+			// an operator or `;`
+			if p.curTokenIs(token.RBRACE) && p.peekPrecedence() == LOWEST &&
+				!p.peekTokenIs(token.ELSE) && !p.peekTokenIs(token.CATCH) &&
+				!p.peekTokenIs(token.FINALLY) && !p.peekTokenIs(token.SEMICOLON) {
+				break
+			}
+			if p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) ||
+				p.peekTokenIs(token.WHILE) || p.peekTokenIs(token.FOR) ||
+				p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+				break
+			}
+		}
+		p.nextToken()
+	}
+	p.panicking = false
+}
+
+func (p *Parser) badExpression(from token.Token) *ast.BadExpression {
+	return &ast.BadExpression{Token: from, Last: p.curToken}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -128,8 +296,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.errorAt(p.curToken, INVALID_INTEGER, msg)
+		return p.badExpression(p.curToken)
+	}
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.errorAt(p.curToken, INVALID_FLOAT, msg)
+		return p.badExpression(p.curToken)
 	}
 	lit.Value = value
 
@@ -137,32 +319,63 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	outerStart, outerDepth := p.stmtStart, p.stmtDepth
+	p.stmtStart, p.stmtDepth = p.curToken, p.depth
+	if p.curTokenIs(token.LBRACE) {
+		p.stmtDepth -= 1
+	}
+	defer func() { p.stmtStart, p.stmtDepth = outerStart, outerDepth }()
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.WHILE:
+		stmt = p.parseWhileStatement()
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseLoopControlStatement()
+	case token.THROW:
+		stmt = p.parseThrowStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
 	}
+
+	if p.panicking && p.curToken == p.stmtStart && p.errors[len(p.errors)-1].Pos == p.stmtStart.Pos {
+		// a stray token, nothing else of the statement has been consumed
+		p.panicking = false
+	}
+	if p.panicking {
+		p.synchronize()
+		if bad, ok := stmt.(*ast.BadStatement); ok {
+			bad.Last = p.curToken
+		}
+	}
+	return stmt
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
-		return nil
+		return &ast.BadStatement{Token: stmt.Token}
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	if !p.expectPeek(token.ASSIGN) {
-		return nil
+		return &ast.BadStatement{Token: stmt.Token}
 	}
 
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -184,9 +397,97 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return &ast.BadStatement{Token: stmt.Token}
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return &ast.BadStatement{Token: stmt.Token}
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return &ast.BadStatement{Token: stmt.Token}
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return &ast.BadStatement{Token: stmt.Token}
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return &ast.BadStatement{Token: stmt.Token}
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	defer func() { p.loopDepth -= 1 }()
+
+	return p.parseBlockStatement()
+}
+
+// break or continue
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s outside of a loop", p.curToken.Literal)
+		p.errorAt(p.curToken, OUTSIDE_LOOP, msg)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	d := p.errorAt(p.curToken, NO_PREFIX_PARSE, msg)
+	if t == token.ASSIGN {
+		d.Hint = "use == to compare values"
+	}
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
@@ -203,7 +504,13 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		bad := p.badExpression(p.curToken)
+		if p.isTerminator(p.curToken.Type) && p.curToken != p.stmtStart {
+			// leave the terminator to the enclosing construct
+			bad.Last = p.prevToken
+			p.backup()
+		}
+		return bad
 	}
 	leftExp := prefix()
 
@@ -241,16 +548,43 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	valid := true
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", target.String())
+		p.errorAt(p.curToken, INVALID_TARGET, msg)
+		valid = false
+	}
+
+	// right associative, a = b = c assigns c to b first
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	if !valid {
+		return p.badExpression(expression.Token)
+	}
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return p.badExpression(lparen)
 	}
 
 	return exp
@@ -260,21 +594,21 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	exp := &ast.IfExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
-		return nil
-	}
-	exp.Condition = p.parseExpression(LOWEST)
-	if !p.curTokenIs(token.RPAREN) {
-		return nil
+		return p.badExpression(exp.Token)
 	}
 	p.nextToken()
+	exp.Condition = p.parseExpression(LOWEST)
 
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return p.badExpression(exp.Token)
+	}
 	exp.Consequence = p.parseBlockStatement()
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
 		if !p.expectPeek(token.LBRACE) {
-			return nil
+			return p.badExpression(exp.Token)
 		}
 		exp.Alternative = p.parseBlockStatement()
 	}
@@ -282,14 +616,51 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
-func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	if !p.curTokenIs(token.LBRACE) {
-		return nil
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return p.badExpression(exp.Token)
 	}
-	p.nextToken()
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return p.badExpression(exp.Token)
+		}
+		exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return p.badExpression(exp.Token)
+		}
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
 
+		if !p.expectPeek(token.LBRACE) {
+			return p.badExpression(exp.Token)
+		}
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		msg := fmt.Sprintf("expected catch or finally after the try block, got %s instead", p.peekToken.Type)
+		d := p.errorAt(p.peekToken, UNEXPECTED_TOKEN, msg)
+		d.Expected = []token.TokenType{token.CATCH, token.FINALLY}
+		return p.badExpression(exp.Token)
+	}
+
+	return exp
+}
+
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
@@ -299,6 +670,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
+	} else {
+		p.expectError(p.curToken, token.RBRACE)
+	}
+
 	return block
 }
 
@@ -306,16 +683,23 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
-		return nil
+		return p.badExpression(lit.Token)
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return p.badExpression(lit.Token)
+	}
 
 	if !p.expectPeek(token.LBRACE) {
-		return nil
+		return p.badExpression(lit.Token)
 	}
 
+	// loops around the function literal can't be left from its body
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = outerLoopDepth
 
 	return lit
 }
@@ -328,14 +712,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		p.nextToken()
 		return identifiers
 	}
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // current token is comma
-		p.nextToken() // skip comma
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
@@ -350,6 +738,10 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return p.badExpression(exp.Token)
+	}
+	exp.Rparen = p.curToken
 	return exp
 }
 
@@ -380,9 +772,41 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.curToken}
+	template.Parts = append(template.Parts, p.parseStringLiteral())
+
+	for {
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) || p.peekTokenIs(token.TEMPLATE_TAIL) {
+			p.errorAt(p.peekToken, NO_PREFIX_PARSE, "expected an expression inside ${}")
+			return p.badExpression(template.Token)
+		}
+		p.nextToken()
+		template.Parts = append(template.Parts, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) {
+			break
+		}
+		p.nextToken()
+		template.Parts = append(template.Parts, p.parseStringLiteral())
+	}
+
+	if !p.expectPeek(token.TEMPLATE_TAIL) {
+		return p.badExpression(template.Token)
+	}
+	template.Parts = append(template.Parts, p.parseStringLiteral())
+	template.Tail = p.curToken
+
+	return template
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return p.badExpression(array.Token)
+	}
+	array.Rbracket = p.curToken
 
 	return array
 }
@@ -419,8 +843,9 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp.Index = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RBRACKET) {
-		return nil
+		return p.badExpression(exp.Token)
 	}
+	exp.Rbracket = p.curToken
 	return exp
 }
 
@@ -433,7 +858,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		key := p.parseExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
-			return nil
+			return p.badExpression(hash.Token)
 		}
 
 		p.nextToken()
@@ -441,17 +866,29 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		hash.Pairs[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
-			return nil
+			return p.badExpression(hash.Token)
 		}
 	}
 
 	if !p.expectPeek(token.RBRACE) {
 		// invalid expression
-		return nil
+		return p.badExpression(hash.Token)
 	}
+	hash.Rbrace = p.curToken
 	return hash
 }
 
+// tokens which close an enclosing construct and can never start an expression
+func (p *Parser) isTerminator(t token.TokenType) bool {
+	switch t {
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.COMMA, token.SEMICOLON, token.EOF,
+		token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
 )
 
 func TestLetStatement(t *testing.T) {
@@ -116,6 +117,30 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := `2.5e-1;`
+	program := getProgram(t, input)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d instead", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ExpressionStatement, got %T instead", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.FloatLiteral, got %T instead", stmt.Expression)
+	}
+	if literal.Value != 0.25 {
+		t.Errorf("expected literal.Value to be 0.25, got %g instead", literal.Value)
+	}
+	if literal.TokenLiteral() != "2.5e-1" {
+		t.Errorf("expected literal.TokenLiteral() to be '2.5e-1', got %q instead", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	tests := []struct {
 		input        string
@@ -231,6 +256,13 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a + b % c * d", "(a + ((b % c) * d))"},
+		{"a <= b == b >= c", "((a <= b) == (b >= c))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"!a && b", "((!a) && b)"},
+		{"x = a || b", "(x = (a || b))"},
 	}
 
 	for _, tt := range tests {
@@ -242,6 +274,49 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x += 1 + 2", "(x += (1 + 2))"},
+		{"a = b = c", "(a = (b = c))"},
+		{"a[i] *= 2", "((a[i]) *= 2)"},
+		{`h["k"] /= x == y`, "((h[k]) /= (x == y))"},
+		{"f(x = 1)", "f((x = 1))"},
+	}
+
+	for _, tt := range tests {
+		program := getProgram(t, tt.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement, got %d instead", len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.String() != tt.expected {
+			t.Errorf("expected %q, got %q instead", tt.expected, stmt.String())
+		}
+	}
+
+	program, errors := parseWithErrors("1 + x = 2; f() += 1;")
+	expected := []string{
+		"1:7: cannot assign to (1 + x)",
+		"1:16: cannot assign to f()",
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d instead: %q", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("expected error %q, got %q instead", msg, errors[i])
+		}
+	}
+	if _, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.BadExpression); !ok {
+		t.Errorf("expected *ast.BadExpression, got %s instead", program.Statements[0].String())
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -307,6 +382,107 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; continue; }`
+
+	program := getProgram(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d instead", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("expected *ast.WhileStatement, got %T instead", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("expected 3 body statements, got %d instead", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("expected *ast.BreakStatement, got %T instead", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("expected *ast.ContinueStatement, got %T instead", stmt.Body.Statements[2])
+	}
+	if stmt.String() != "while(x < y) xbreak;continue;" {
+		t.Errorf("unexpected string %q", stmt.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { if (x > 1) { break } }`
+
+	program := getProgram(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d instead", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ForStatement, got %T instead", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("expected iterable to be [1, 2], got %s instead", stmt.Iterable.String())
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("expected 1 body statement, got %d instead", len(stmt.Body.Statements))
+	}
+	if stmt.End().String() != "1:43" {
+		t.Errorf("expected statement to end at 1:43, got %s instead", stmt.End())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { x } catch (e) { throw e; } finally { y }`
+
+	program := getProgram(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d instead", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ExpressionStatement, got %T instead", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("expected *ast.TryExpression, got %T instead", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Param, "e") {
+		return
+	}
+	if len(exp.Catch.Statements) != 1 {
+		t.Fatalf("expected 1 catch statement, got %d instead", len(exp.Catch.Statements))
+	}
+	throw, ok := exp.Catch.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ThrowStatement, got %T instead", exp.Catch.Statements[0])
+	}
+	if !testIdentifier(t, throw.Value, "e") {
+		return
+	}
+	if exp.String() != "try xcatch(e) throw e;finally y" {
+		t.Errorf("unexpected string %q", exp.String())
+	}
+	if exp.End().String() != "1:47" {
+		t.Errorf("expected expression to end at 1:47, got %s instead", exp.End())
+	}
+
+	program = getProgram(t, "try { x } finally { y }")
+	exp, ok = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("expected *ast.TryExpression, got %T instead", program.Statements[0])
+	}
+	if exp.Param != nil || exp.Catch != nil || exp.Finally == nil {
+		t.Errorf("expected a finally clause alone, got %q", exp.String())
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := `if (x < y) { x } else { y }`
 
@@ -466,6 +642,59 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedText  []string
+		expectedExprs []string
+	}{
+		{`"${x}"`, []string{"", ""}, []string{"x"}},
+		{`"a ${x + 1} b ${f(y)}!"`, []string{"a ", " b ", "!"}, []string{"(x + 1)", "f(y)"}},
+		{`"${ {"k": "${v}"}["k"] }"`, []string{"", ""}, []string{`({k: "${v}"}[k])`}},
+		{`"\${x} ${"\"q\""}"`, []string{"${x} ", ""}, []string{`"q"`}},
+	}
+
+	for _, tt := range tests {
+		program := getProgram(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		template, ok := stmt.Expression.(*ast.TemplateLiteral)
+		if !ok {
+			t.Fatalf("expected *ast.TemplateLiteral, got %T instead", stmt.Expression)
+		}
+		if len(template.Parts) != len(tt.expectedText)+len(tt.expectedExprs) {
+			t.Fatalf("expected %d parts, got %d instead", len(tt.expectedText)+len(tt.expectedExprs), len(template.Parts))
+		}
+		for i, part := range template.Parts {
+			if i%2 == 0 {
+				text, ok := part.(*ast.StringLiteral)
+				if !ok || text.Value != tt.expectedText[i/2] {
+					t.Errorf("expected text %q, got %s instead", tt.expectedText[i/2], part)
+				}
+			} else if part.String() != tt.expectedExprs[i/2] {
+				t.Errorf("expected expression %q, got %q instead", tt.expectedExprs[i/2], part.String())
+			}
+		}
+		if template.End().Offset != len(tt.input) {
+			t.Errorf("expected template to end at %d, got %d instead", len(tt.input), template.End().Offset)
+		}
+	}
+
+	_, errors := parseWithErrors(`"a ${} b"; "${1 + } c"; "${x`)
+	expected := []string{
+		"1:6: expected an expression inside ${}",
+		"1:19: no prefix parse function for TEMPLATE_TAIL found",
+		"1:29: expected next token to be TEMPLATE_TAIL, got EOF instead",
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d instead: %q", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("expected error %q, got %q instead", msg, errors[i])
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -579,6 +808,276 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2, 3][0]);`
+
+	program := getProgram(t, input)
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{program, "1:1", "4:18"},
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body.Statements[0], "2:3", "2:8"},
+		{program.Statements[1], "4:1", "4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8", "4:17"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.node.Pos().String(); got != tt.expectedStart {
+			t.Errorf("expected %q to start at %s, got %s instead", tt.node.String(), tt.expectedStart, got)
+		}
+		if got := tt.node.End().String(); got != tt.expectedEnd {
+			t.Errorf("expected %q to end at %s, got %s instead", tt.node.String(), tt.expectedEnd, got)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x = (1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d instead: %v", len(diagnostics), p.Errors())
+	}
+
+	d := diagnostics[0]
+	if d.Severity != ERROR {
+		t.Errorf("expected severity %s, got %s instead", ERROR, d.Severity)
+	}
+	if d.Code != UNEXPECTED_TOKEN {
+		t.Errorf("expected code %q, got %q instead", UNEXPECTED_TOKEN, d.Code)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.RPAREN {
+		t.Errorf("expected Expected to be [%s], got %v instead", token.RPAREN, d.Expected)
+	}
+	if d.Actual != token.SEMICOLON {
+		t.Errorf("expected Actual to be %s, got %s instead", token.SEMICOLON, d.Actual)
+	}
+
+	expectedString := "1:11: expected next token to be ), got ; instead"
+	if p.Errors()[0] != expectedString {
+		t.Errorf("expected error %q, got %q instead", expectedString, p.Errors()[0])
+	}
+
+	expectedExcerpt := "1:11: error: expected next token to be ), got ; instead\n" +
+		"  let x = (1;\n" +
+		"            ^\n"
+	if d.Excerpt(input) != expectedExcerpt {
+		t.Errorf("expected excerpt\n%s\ngot\n%s", expectedExcerpt, d.Excerpt(input))
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements int
+	}{
+		{
+			"let x 5;\nlet y = (1 + ;\nlet z = [1, 2;\nlet w = 10;",
+			[]string{
+				"1:7: expected next token to be =, got INT instead",
+				"2:14: no prefix parse function for ; found",
+				"3:14: expected next token to be ], got ; instead",
+			},
+			4,
+		},
+		{
+			"let g = fn(a, 1) { a };\nif (x { 1 } else { 2 }\nputs(1, , 2);\n{\"a\" 1}",
+			[]string{
+				"1:15: expected next token to be IDENT, got INT instead",
+				"2:7: expected next token to be ), got { instead",
+				"3:9: no prefix parse function for , found",
+				"4:6: expected next token to be :, got INT instead",
+			},
+			4,
+		},
+		{
+			"let f = fn(x) { let = x; x + };\nf(1",
+			[]string{
+				"1:21: expected next token to be IDENT, got = instead",
+				"1:30: no prefix parse function for } found",
+				"2:4: expected next token to be ), got EOF instead",
+			},
+			2,
+		},
+		{
+			"break;\nwhile (x) { fn() { continue } }\nfor (1 in xs) { x }\nlet y = 1;",
+			[]string{
+				"1:1: break outside of a loop",
+				"2:20: continue outside of a loop",
+				"3:6: expected next token to be IDENT, got INT instead",
+			},
+			4,
+		},
+		{
+			"try { 1 };\ntry { 2 } catch { 3 }\nlet y = 1;",
+			[]string{
+				"1:10: expected catch or finally after the try block, got ; instead",
+				"2:17: expected next token to be (, got { instead",
+			},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		program, errors := parseWithErrors(tt.input)
+
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("expected %d errors, got %d instead: %q", len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("expected error %q, got %q instead", msg, errors[i])
+			}
+		}
+		if len(program.Statements) != tt.expectedStatements {
+			t.Errorf("expected %d statements, got %d instead: %s", tt.expectedStatements, len(program.Statements), program.String())
+		}
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	input := "let a = 1 & 2;\nlet b = @ + 1;\nlet c = \"x\\q\";\nlet d = 1; /* open"
+
+	expected := []struct {
+		code Code
+		msg  string
+	}{
+		{INVALID_CHARACTER, "1:11: invalid character '&'"},
+		{INVALID_CHARACTER, "2:9: invalid character '@'"},
+		{INVALID_ESCAPE, "3:11: invalid escape sequence \\q"},
+		{UNTERMINATED_COMMENT, "4:12: unterminated block comment"},
+	}
+
+	_, errors := parseWithErrors(input)
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d instead: %q", len(expected), len(errors), errors)
+	}
+	for i, e := range expected {
+		if errors[i] != e.msg {
+			t.Errorf("expected error %q, got %q instead", e.msg, errors[i])
+		}
+	}
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+	for i, d := range p.Diagnostics() {
+		if d.Code != expected[i].code {
+			t.Errorf("expected code %q, got %q instead", expected[i].code, d.Code)
+		}
+	}
+}
+
+func TestBadNodes(t *testing.T) {
+	program, _ := parseWithErrors("let 5;\nlet x = (1 + 2;\nx;")
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d instead", len(program.Statements))
+	}
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("expected *ast.BadStatement, got %T instead", program.Statements[0])
+	}
+	if bad.Pos().String() != "1:1" || bad.End().String() != "1:7" {
+		t.Errorf("expected bad statement to span 1:1-1:7, got %s-%s instead", bad.Pos(), bad.End())
+	}
+
+	stmt, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("expected *ast.LetStatement, got %T instead", program.Statements[1])
+	}
+	if _, ok := stmt.Value.(*ast.BadExpression); !ok {
+		t.Errorf("expected *ast.BadExpression, got %T instead", stmt.Value)
+	}
+
+	testIdentifier(t, program.Statements[2].(*ast.ExpressionStatement).Expression, "x")
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 1; // trailing
+let f = fn() {
+	/* inside */
+	x
+	// dangling
+};
+let h = {
+	"a": 1, // enclosed
+};
+// end`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.SCAN_COMMENTS)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d instead", len(program.Statements))
+	}
+	if len(program.Comments) != 6 {
+		t.Fatalf("expected 6 comments, got %d instead", len(program.Comments))
+	}
+
+	body := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+	expected := []struct {
+		node     ast.Node
+		comments []string
+	}{
+		{program.Statements[0], []string{"// leading", "// trailing"}},
+		{body.Statements[0], []string{"/* inside */"}},
+		{body, []string{"// dangling"}},
+		{program.Statements[2], []string{"// enclosed"}},
+		{program, []string{"// end"}},
+	}
+
+	cmap := ast.NewCommentMap(program)
+	if len(cmap) != len(expected) {
+		t.Errorf("expected comments on %d nodes, got %d instead", len(expected), len(cmap))
+	}
+	for _, e := range expected {
+		comments := cmap[e.node]
+		if len(comments) != len(e.comments) {
+			t.Errorf("expected %q on %s, got %d comments instead", e.comments, e.node, len(comments))
+			continue
+		}
+		for i, c := range comments {
+			if c.Text != e.comments[i] {
+				t.Errorf("expected comment %q on %s, got %q instead", e.comments[i], e.node, c.Text)
+			}
+		}
+	}
+
+	program = getProgram(t, input)
+	if len(program.Statements) != 3 || program.Comments != nil {
+		t.Errorf("expected comments to be skipped, got %d statements and %d comments",
+			len(program.Statements), len(program.Comments))
+	}
+}
+
+func parseWithErrors(input string) (*ast.Program, []string) {
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	return program, p.Errors()
+}
+
 func getProgram(t *testing.T, input string) *ast.Program {
 	l := lexer.New(input)
 	p := New(l)
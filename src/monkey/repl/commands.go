@@ -0,0 +1,107 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
+)
+
+// Command is run by entering `:name arg` in the REPL
+type Command struct {
+	Name string
+	Args string // argument shown by :help, e.g. "<src>"
+	Help string
+	Run  func(s *Session, arg string)
+}
+
+// commands by name
+var commands = map[string]*Command{}
+
+// RegisterCommand makes cmd available in every REPL, replacing the command
+// of the same name
+func RegisterCommand(cmd *Command) {
+	commands[cmd.Name] = cmd
+}
+
+func init() {
+	RegisterCommand(&Command{Name: "tokens", Args: "<src>", Help: "show the tokens of src", Run: tokensCommand})
+	RegisterCommand(&Command{Name: "ast", Args: "<src>", Help: "show the syntax tree of src", Run: astCommand})
+	RegisterCommand(&Command{Name: "env", Help: "list the bindings of the session", Run: envCommand})
+	RegisterCommand(&Command{Name: "load", Args: "<file>", Help: "execute a script in the session", Run: loadCommand})
+	RegisterCommand(&Command{Name: "reset", Help: "discard all bindings", Run: resetCommand})
+	RegisterCommand(&Command{Name: "help", Help: "list the commands", Run: helpCommand})
+}
+
+// run the `:name arg` command line
+func (s *Session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.err, "unknown command :%s, type :help for the list of commands\n", name)
+		return
+	}
+	cmd.Run(s, strings.TrimSpace(arg))
+}
+
+func tokensCommand(s *Session, arg string) {
+	l := lexer.New(arg)
+	l.SetMode(lexer.SCAN_COMMENTS)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-16s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func astCommand(s *Session, arg string) {
+	l := lexer.New(arg)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	printParserErrors(s.err, arg, p.Diagnostics())
+	for _, stmt := range program.Statements {
+		ast.Fprint(s.out, stmt)
+	}
+}
+
+func envCommand(s *Session, arg string) {
+	for _, b := range s.Bindings() {
+		fmt.Fprintf(s.out, "%s = %s\n", b.Name, b.Value.Inspect())
+	}
+}
+
+func loadCommand(s *Session, arg string) {
+	if arg == "" {
+		io.WriteString(s.err, "usage: :load <file>\n")
+		return
+	}
+	src, err := os.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintf(s.err, "%s\n", err)
+		return
+	}
+	s.eval(arg, string(src))
+}
+
+func resetCommand(s *Session, arg string) {
+	s.Reset()
+}
+
+func helpCommand(s *Session, arg string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := commands[name]
+		usage := strings.TrimSpace(":" + cmd.Name + " " + cmd.Args)
+		fmt.Fprintf(s.out, "%-16s %s\n", usage, cmd.Help)
+	}
+}
@@ -0,0 +1,297 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// maximum number of lines kept in the history
+const MAX_HISTORY = 1000
+
+// returned by readLine when the line is discarded with ctrl-c
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal in raw mode, with emacs style
+// cursor movement, history and tab completion
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string // every line read is appended to it, if set
+
+	// words starting with the word before the cursor
+	complete func(word string) []string
+}
+
+func newLineEditor(in io.Reader, out io.Writer) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// loadHistory reads the history from filename and appends the following
+// lines to it, a missing file is created on the first line
+func (e *lineEditor) loadHistory(filename string) {
+	e.historyFile = filename
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > MAX_HISTORY {
+		e.history = e.history[len(e.history)-MAX_HISTORY:]
+	}
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > MAX_HISTORY {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, line+"\n")
+}
+
+// readLine shows prompt and reads a line, it returns errInterrupted on ctrl-c
+// and io.EOF on ctrl-d in an empty line
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	line := []rune{}
+	pos := 0 // cursor
+
+	// history entry shown, len(history) for the new line saved in pending
+	index := len(e.history)
+	pending := []rune{}
+	recall := func(i int) {
+		if i < 0 || i > len(e.history) || i == index {
+			return
+		}
+		if index == len(e.history) {
+			pending = line
+		}
+		index = i
+		if i == len(e.history) {
+			line = pending
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+	}
+	insert := func(rs []rune) {
+		rest := append(rs, line[pos:]...)
+		line = append(line[:pos], rest...)
+		pos += len(rs)
+	}
+
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			e.addHistory(string(line))
+			return string(line), nil
+		case 3: // ctrl-c
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // ctrl-d
+			if len(line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 127, 8: // backspace, ctrl-h
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos -= 1
+			}
+		case 1: // ctrl-a
+			pos = 0
+		case 5: // ctrl-e
+			pos = len(line)
+		case 2: // ctrl-b
+			if pos > 0 {
+				pos -= 1
+			}
+		case 6: // ctrl-f
+			if pos < len(line) {
+				pos += 1
+			}
+		case 11: // ctrl-k, delete to the end of the line
+			line = line[:pos]
+		case 21: // ctrl-u, delete to the start of the line
+			line = line[pos:]
+			pos = 0
+		case 23: // ctrl-w, delete the word before the cursor
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start -= 1
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start -= 1
+			}
+			line = append(line[:start], line[pos:]...)
+			pos = start
+		case 16: // ctrl-p
+			recall(index - 1)
+		case 14: // ctrl-n
+			recall(index + 1)
+		case 12: // ctrl-l, clear the screen
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case '\t':
+			insert(e.completion(line, pos))
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case 'A':
+				recall(index - 1)
+			case 'B':
+				recall(index + 1)
+			case 'C':
+				if pos < len(line) {
+					pos += 1
+				}
+			case 'D':
+				if pos > 0 {
+					pos -= 1
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '~': // delete
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				insert([]rune{r})
+			}
+		}
+		e.refresh(prompt, line, pos)
+	}
+
+	io.WriteString(e.out, "\r\n")
+	return string(line), nil
+}
+
+// read the rest of an escape sequence like ESC [ A, returning A for up, B
+// for down, C for right, D for left, H for home, F for end, ~ for delete
+// and 0 for the unknown sequences
+func (e *lineEditor) readEscape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+
+	params := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if r < '0' || r > '9' && r != ';' {
+			break
+		}
+		params += string(r)
+	}
+
+	switch {
+	case r != '~':
+		if strings.ContainsRune("ABCDHF", r) {
+			return r
+		}
+	case params == "1" || params == "7":
+		return 'H'
+	case params == "4" || params == "8":
+		return 'F'
+	case params == "3":
+		return '~'
+	}
+	return 0
+}
+
+// runes completing the word before the cursor, a list of the candidates is
+// shown when there are several
+func (e *lineEditor) completion(line []rune, pos int) []rune {
+	if e.complete == nil {
+		return nil
+	}
+
+	start := pos
+	for start > 0 && isWordChar(line[start-1]) {
+		start -= 1
+	}
+	if start == 1 && line[0] == ':' {
+		start = 0 // command
+	}
+	word := string(line[start:pos])
+	if word == "" {
+		return nil
+	}
+
+	candidates := e.complete(word)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return nil
+	}
+	// compared by runes, not to split a multi-byte character
+	common := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		n := 0
+		for _, ch := range c {
+			if n == len(common) || common[n] != ch {
+				break
+			}
+			n += 1
+		}
+		common = common[:n]
+	}
+	if len(candidates) > 1 && string(common) == word {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+	return common[len([]rune(word)):]
+}
+
+// redraw the line and place the cursor
+func (e *lineEditor) refresh(prompt string, line []rune, pos int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+	if n := len(line) - pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+func isWordChar(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
@@ -0,0 +1,107 @@
+package repl
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let x = 1\r", "let x = 1"},
+		{"abc\x7f\x7fd\r", "ad"},
+		{"bc\x01a\x05d\r", "abcd"},                  // ctrl-a, ctrl-e
+		{"ac\x1b[Db\x1b[C!\r", "abc!"},              // left, right
+		{"abc\x1b[H\x1b[3~\x1b[F.\r", "bc."},        // home, delete, end
+		{"abc\x02\x02\x0b\r", "a"},                  // ctrl-b, ctrl-k
+		{"abc\x02\x15\r", "c"},                      // ctrl-u
+		{"let foo = bar\x17baz\r", "let foo = baz"}, // ctrl-w
+		{"héllo\x02\x02x\r", "hélxlo"},
+		{"abc", "abc"}, // end of input
+	}
+
+	for _, tt := range tests {
+		e := newLineEditor(strings.NewReader(tt.keys), io.Discard)
+		line, err := e.readLine(">> ")
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("expected line %q for %q, got %q instead", tt.expected, tt.keys, line)
+		}
+	}
+
+	e := newLineEditor(strings.NewReader("a\x03\x04"), io.Discard)
+	if _, err := e.readLine(">> "); err != errInterrupted {
+		t.Errorf("expected errInterrupted on ctrl-c, got %v instead", err)
+	}
+	if _, err := e.readLine(">> "); err != io.EOF {
+		t.Errorf("expected io.EOF on ctrl-d, got %v instead", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	os.WriteFile(filename, []byte("old\n"), 0600)
+
+	keys := "one\rtwo\rtwo\r \r" +
+		"\x1b[A\x1b[A\x1b[B!\r" + // two!
+		"new\x10\x10\x0e\x0e\r" + // back to new
+		"\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r" // the oldest entry
+	e := newLineEditor(strings.NewReader(keys), io.Discard)
+	e.loadHistory(filename)
+
+	expected := []string{"one", "two", "two", " ", "two!", "new", "old"}
+	for _, want := range expected {
+		line, err := e.readLine(">> ")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if line != want {
+			t.Errorf("expected line %q, got %q instead", want, line)
+		}
+	}
+
+	data, _ := os.ReadFile(filename)
+	if string(data) != "old\none\ntwo\ntwo!\nnew\nold\n" {
+		t.Errorf("unexpected history file %q", data)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	session := NewSession(ENGINE_EVAL, io.Discard, io.Discard)
+	session.eval("", "let first_name = 1; let fizz = 2; let aé = 3; let aè = 4;")
+
+	tests := []struct {
+		keys     string
+		expected string
+		output   string // candidates shown
+	}{
+		{"ret\t(1)\r", "return(1)", ""},
+		{"fir\t\t\r", "first", "first  first_name"},
+		{"fi\t\r", "fi", "finally  first  first_name  fizz"},
+		{"first_\t\r", "first_name", ""},
+		{"a\t\r", "a", "aè  aé"},
+		{"puts(fiz\t)\r", "puts(fizz)", ""},
+		{":he\t\r", ":help", ""},
+		{"xyz\t\r", "xyz", ""},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := newLineEditor(strings.NewReader(tt.keys), &out)
+		e.complete = session.complete
+		line, _ := e.readLine(">> ")
+		if line != tt.expected {
+			t.Errorf("expected line %q for %q, got %q instead", tt.expected, tt.keys, line)
+		}
+		if tt.output != "" && !strings.Contains(out.String(), "\r\n"+tt.output+"\r\n") {
+			t.Errorf("expected candidates %q for %q, got %q instead", tt.output, tt.keys, out.String())
+		}
+	}
+}
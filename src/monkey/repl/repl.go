@@ -2,51 +2,334 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
+	"context"
+	"errors"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
-	"github.com/pqppq/writing-an-interpreter-in-go/monkey/evaluator"
+	"golang.org/x/term"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
 	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/token"
+)
+
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. " // more lines are needed to complete the input
+)
+
+// backend executing the programs
+type Engine = monkey.Engine
+
+const (
+	ENGINE_EVAL = monkey.ENGINE_EVAL
+	ENGINE_VM   = monkey.ENGINE_VM
 )
 
-const PROMPT = ">> "
+// Start runs a REPL with the default options reading from in and writing
+// to out
+func Start(in io.Reader, out io.Writer, engine Engine) {
+	New(engine).Run(in, out)
+}
+
+// REPL reads the input line by line, an incomplete statement is continued
+// on the next lines until it is complete or an empty line is entered. Lines
+// starting with : are commands, see :help. A terminal input can be edited,
+// with history and tab completion
+type REPL struct {
+	Engine             Engine
+	Prompt             string
+	ContinuationPrompt string        // shown while more lines are needed
+	Banner             string        // written when the REPL starts
+	Limits             object.Limits // of the executions in the sessions created by Run
+
+	Stdout io.Writer // prompts, values and the output of puts, out of Run if nil
+	Stderr io.Writer // errors, Stdout if nil
+}
+
+func New(engine Engine) *REPL {
+	return &REPL{Engine: engine, Prompt: PROMPT, ContinuationPrompt: CONTINUATION_PROMPT}
+}
+
+// Run reads from in until it ends, a connection can be served with
+// Run(conn, conn)
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	stdout, stderr := r.Stdout, r.Stderr
+	if stdout == nil {
+		stdout = out
+	}
+	if stderr == nil {
+		stderr = stdout
+	}
+
+	session := NewSession(r.Engine, stdout, stderr)
+	session.SetLimits(r.Limits)
+	return r.RunSession(session, in)
+}
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+// RunSession reads from in until it ends, executing in session and writing to
+// the writers of session
+func (r *REPL) RunSession(session *Session, in io.Reader) error {
+	reader := newLineReader(in, session.out, session)
+	lines := []string{}
 
+	io.WriteString(session.out, r.Banner)
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		prompt := r.Prompt
+		if len(lines) > 0 {
+			prompt = r.ContinuationPrompt
+		}
+		line, err := reader.readLine(prompt)
+		if err == errInterrupted {
+			lines = lines[:0]
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(lines) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			session.command(strings.TrimSpace(line))
+			continue
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		force := len(lines) > 0 && strings.TrimSpace(line) == ""
+		lines = append(lines, line)
+		src := strings.Join(lines, "\n")
+
+		l := lexer.New(src)
 		p := parser.New(l)
 		program := p.ParseProgram()
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if len(p.Errors()) != 0 && !force && isIncomplete(p.Diagnostics()) {
 			continue
 		}
+		lines = lines[:0]
+		session.run(src, program, p.Diagnostics())
+	}
+}
+
+// reads the input lines, showing the prompt
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor if in is a terminal
+func newLineReader(in io.Reader, out io.Writer, session *Session) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	}
+
+	editor := newLineEditor(f, out)
+	editor.complete = session.complete
+	if dir, err := os.UserConfigDir(); err == nil {
+		dir = filepath.Join(dir, "monkey")
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			editor.loadHistory(filepath.Join(dir, "history"))
+		}
+	}
+	return &terminalReader{fd: int(f.Fd()), editor: editor}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// switches the terminal to raw mode while a line is edited
+type terminalReader struct {
+	fd     int
+	editor *lineEditor
+}
+
+func (r *terminalReader) readLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+	return r.editor.readLine(prompt)
+}
+
+// Session is an environment persisting between the inputs of a REPL
+type Session struct {
+	env *environment
+	ctx context.Context
+	out io.Writer
+	err io.Writer
+}
+
+// bindings of one or more sessions
+type environment struct {
+	mu      sync.Mutex // serializes the executions of the sessions
+	options monkey.Options
+	interp  *monkey.Interpreter
+}
+
+// NewSession returns a session writing values and the output of puts to
+// out, and errors to err
+func NewSession(engine Engine, out, err io.Writer) *Session {
+	options := monkey.Options{Engine: engine}
+	env := &environment{options: options, interp: monkey.New(options)}
+	return &Session{env: env, ctx: context.Background(), out: out, err: err}
+}
+
+// Share returns a session writing to out and err which shares the bindings
+// of s, the executions of both are serialized
+func (s *Session) Share(out, err io.Writer) *Session {
+	return &Session{env: s.env, ctx: context.Background(), out: out, err: err}
+}
+
+// SetContext sets the context of the executions of s, they are stopped
+// when it is done
+func (s *Session) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// SetLimits sets the limits of the executions of s and the sessions sharing
+// its bindings
+func (s *Session) SetLimits(limits object.Limits) {
+	s.env.mu.Lock()
+	defer s.env.mu.Unlock()
+	s.env.options.Limits = limits
+	s.env.interp.SetLimits(limits)
+}
+
+// Out returns the writer receiving the values and the output of puts
+func (s *Session) Out() io.Writer {
+	return s.out
+}
+
+// Err returns the writer receiving the errors
+func (s *Session) Err() io.Writer {
+	return s.err
+}
+
+// Reset discards all the bindings of the session
+func (s *Session) Reset() {
+	s.env.mu.Lock()
+	defer s.env.mu.Unlock()
+	s.env.interp = monkey.New(s.env.options)
+}
+
+// a name bound in the session
+type Binding struct {
+	Name  string
+	Value object.Object
+}
+
+// Bindings returns the global bindings of the session sorted by name
+func (s *Session) Bindings() []Binding {
+	s.env.mu.Lock()
+	defer s.env.mu.Unlock()
+	bindings := []Binding{}
+	for _, name := range s.env.interp.Names() {
+		value, _ := s.env.interp.Get(name)
+		bindings = append(bindings, Binding{Name: name, Value: value})
+	}
+	return bindings
+}
+
+// complete returns the commands, keywords, builtins and bindings starting
+// with word, sorted
+func (s *Session) complete(word string) []string {
+	names := []string{}
+	if strings.HasPrefix(word, ":") {
+		for name := range commands {
+			names = append(names, ":"+name)
+		}
+	} else {
+		names = append(names, token.Keywords()...)
+		for _, b := range object.Builtins {
+			names = append(names, b.Name)
+		}
+		for _, b := range s.Bindings() {
+			names = append(names, b.Name)
+		}
+	}
+	sort.Strings(names)
+
+	candidates := []string{}
+	for i, name := range names {
+		if strings.HasPrefix(name, word) && (i == 0 || name != names[i-1]) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// eval executes the source of filename and writes its value or the errors
+// to the output
+func (s *Session) eval(filename, src string) {
+	l := lexer.NewFile(filename, src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	s.run(src, program, p.Diagnostics())
+}
+
+func (s *Session) run(src string, program *ast.Program, diagnostics []parser.Diagnostic) {
+	if len(diagnostics) != 0 {
+		printParserErrors(s.err, src, diagnostics)
+		return
+	}
+
+	s.env.mu.Lock()
+	s.env.interp.SetStdout(s.out)
+	evaluated, err := s.env.interp.RunContext(s.ctx, program)
+	s.env.mu.Unlock()
+
+	if err != nil {
+		var rerr *monkey.RuntimeError
+		if errors.As(err, &rerr) {
+			io.WriteString(s.err, rerr.Err.Traceback()+"\n")
+		} else {
+			io.WriteString(s.err, err.Error()+"\n")
+		}
+		return
+	}
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect()+"\n")
+	}
+}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+// isIncomplete reports whether the diagnostics only complain about the input
+// ending too early, e.g. with unbalanced brackets, a trailing operator or an
+// open string, so that more input could complete it
+func isIncomplete(diagnostics []parser.Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Actual != token.EOF && d.Code != parser.UNTERMINATED_STRING &&
+			d.Code != parser.UNTERMINATED_COMMENT {
+			return false
 		}
 	}
+	return true
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "🙈🙊🙉\n")
-	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, src string, diagnostics []parser.Diagnostic) {
+	for _, d := range diagnostics {
+		io.WriteString(out, d.Excerpt(src))
 	}
 }
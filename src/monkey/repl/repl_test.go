@@ -0,0 +1,125 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) {\n  x *\n    2\n};\nf(3)\n", "6\n"},
+		{"let s = \"a\nb\";\ns\n", "a\nb\n"},
+		{"[1,\n 2\n]\n", "[1, 2]\n"},
+		{"/* a\ncomment */ 1\n", "1\n"},
+		{"let t = \"${1 +\n1}\"; t\n", "2\n"},
+		// an empty line ends the input
+		{"[1,\n\n5\n", "2:1: error: no prefix parse function for EOF found\n" +
+			"  \n" +
+			"  ^\n" +
+			"  hint: the input ended before the statement was complete\n" +
+			"5\n"},
+		// an error which isn't at the end is reported immediately
+		{"(1 + ) {\n5\n", "1:6: error: no prefix parse function for ) found\n" +
+			"  (1 + ) {\n" +
+			"       ^\n" +
+			"5\n"},
+	}
+
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		for _, tt := range tests {
+			out := runWithoutPrompts(engine, tt.input)
+			if out != tt.expected {
+				t.Errorf("%s: expected output %q for %q, got %q instead", engine, tt.expected, tt.input, out)
+			}
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	script, err := os.CreateTemp(t.TempDir(), "*.mk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script.WriteString("let loaded = 1 + 1;\nloaded * 2")
+	script.Close()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens let x = 1; // c\n", "" +
+			"1:1    LET              \"let\"\n" +
+			"1:5    IDENT            \"x\"\n" +
+			"1:7    =                \"=\"\n" +
+			"1:9    INT              \"1\"\n" +
+			"1:10   ;                \";\"\n" +
+			"1:12   COMMENT          \"// c\"\n"},
+		{":ast -a + 1\n", "" +
+			"ExpressionStatement 1:1-1:7\n" +
+			"  InfixExpression 1:1-1:7 +\n" +
+			"    PrefixExpression 1:1-1:3 -\n" +
+			"      Identifier 1:2-1:3 a\n" +
+			"    IntegerLiteral 1:6-1:7 1\n"},
+		{"let b = 2; let a = \"x\";\n:env\n", "a = x\nb = 2\n"},
+		{"let a = 1;\n:reset\n:env\na\n", "ERROR: identifier not found: a\n"},
+		{":load " + script.Name() + "\nloaded\n", "4\n2\n"},
+		{":nope\n", "unknown command :nope, type :help for the list of commands\n"},
+	}
+
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		for _, tt := range tests {
+			out := runWithoutPrompts(engine, tt.input)
+			if out != tt.expected {
+				t.Errorf("%s: expected output %q for %q, got %q instead", engine, tt.expected, tt.input, out)
+			}
+		}
+	}
+}
+
+func TestWriters(t *testing.T) {
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		var stdout, stderr bytes.Buffer
+		r := New(engine)
+		r.Banner = "hello\n"
+		r.Prompt = "> "
+		r.ContinuationPrompt = ". "
+		r.Stderr = &stderr
+
+		input := "puts(\"a\", 1)\n1 +\n1\n1 + true\nlet = 1\n:nope\nlet f = fn() { 1 + true; 1 }; f()\n"
+		if err := r.Run(strings.NewReader(input), &stdout); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expectedStdout := "hello\n> a\n1\nnull\n> . 2\n> > > > > "
+		if stdout.String() != expectedStdout {
+			t.Errorf("%s: expected stdout %q, got %q instead", engine, expectedStdout, stdout.String())
+		}
+		expectedStderr := "ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+			"1:5: error: expected next token to be IDENT, got = instead\n" +
+			"  let = 1\n" +
+			"      ^\n" +
+			"unknown command :nope, type :help for the list of commands\n" +
+			"ERROR: type mismatch: INTEGER + BOOLEAN\n"
+		if engine == ENGINE_EVAL {
+			expectedStderr += "  at f (1:31)\n"
+		}
+		if stderr.String() != expectedStderr {
+			t.Errorf("%s: expected stderr %q, got %q instead", engine, expectedStderr, stderr.String())
+		}
+	}
+}
+
+// output of a REPL without prompts, errors included
+func runWithoutPrompts(engine Engine, input string) string {
+	var out bytes.Buffer
+	r := New(engine)
+	r.Prompt = ""
+	r.ContinuationPrompt = ""
+	r.Run(strings.NewReader(input), &out)
+	return out.String()
+}
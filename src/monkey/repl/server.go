@@ -0,0 +1,162 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// returned by Serve after Shutdown
+var ErrServerClosed = errors.New("repl: server closed")
+
+// Server runs a REPL session on every connection it accepts
+type Server struct {
+	REPL    *REPL         // prompts and banner of the sessions, its writers are unused
+	Shared  bool          // the sessions share one environment
+	Timeout time.Duration // a session without input for this long is closed, never if 0
+
+	mu        sync.Mutex
+	shared    *Session
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+	sessions  sync.WaitGroup
+
+	ctx    context.Context // of the executions, cancelled by Shutdown
+	cancel context.CancelFunc
+}
+
+func NewServer(r *REPL) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		REPL:      r,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Serve accepts connections on l until the server is shut down, when it
+// returns ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = true
+		s.sessions.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.sessions.Done()
+	}()
+
+	session := s.newSession(conn)
+	var in io.Reader = conn
+	if s.Timeout > 0 {
+		in = &idleReader{conn: conn, timeout: s.Timeout}
+	}
+
+	err := s.REPL.RunSession(session, in)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		io.WriteString(conn, "\nsession timed out\n")
+	}
+}
+
+func (s *Server) newSession(conn net.Conn) *Session {
+	var session *Session
+	if s.Shared {
+		s.mu.Lock()
+		if s.shared == nil {
+			s.shared = NewSession(s.REPL.Engine, io.Discard, io.Discard)
+			s.shared.SetLimits(s.REPL.Limits)
+		}
+		session = s.shared.Share(conn, conn)
+		s.mu.Unlock()
+	} else {
+		session = NewSession(s.REPL.Engine, conn, conn)
+		session.SetLimits(s.REPL.Limits)
+	}
+	session.SetContext(s.ctx)
+	return session
+}
+
+// Shutdown stops accepting connections, closes the open ones, stops the
+// running executions and waits for their sessions to end, or for ctx to be
+// done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// extends the read deadline of conn before every read
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
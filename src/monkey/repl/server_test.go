@@ -0,0 +1,130 @@
+package repl
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		shared   bool
+		expected []string // output of the sessions, run one after another
+	}{
+		{false, []string{"> hi\nnull\n> ", "> ERROR: identifier not found: x\n> "}},
+		{true, []string{"> hi\nnull\n> ", "> 42\n> "}},
+	}
+
+	for _, tt := range tests {
+		server, addr := startServer(t, tt.shared, 0)
+
+		outputs := []string{
+			session(t, addr, "let x = 41;puts(\"hi\")\n"),
+			session(t, addr, "x + 1\n"),
+		}
+		for i, out := range outputs {
+			if out != tt.expected[i] {
+				t.Errorf("shared=%v: expected output %q, got %q instead", tt.shared, tt.expected[i], out)
+			}
+		}
+		server.Shutdown(context.Background())
+	}
+}
+
+func TestServerConcurrentSessions(t *testing.T) {
+	server, addr := startServer(t, false, 0)
+	defer server.Shutdown(context.Background())
+
+	a, b := dial(t, addr), dial(t, addr)
+	io.WriteString(a, "let x = \"a\";\n")
+	io.WriteString(b, "let x = \"b\";\n")
+	io.WriteString(a, "x\n")
+	io.WriteString(b, "x\n")
+	a.(*net.TCPConn).CloseWrite()
+	b.(*net.TCPConn).CloseWrite()
+
+	for conn, expected := range map[net.Conn]string{a: "> > a\n> ", b: "> > b\n> "} {
+		out, _ := io.ReadAll(conn)
+		if string(out) != expected {
+			t.Errorf("expected output %q, got %q instead", expected, out)
+		}
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	server, addr := startServer(t, false, 50*time.Millisecond)
+	defer server.Shutdown(context.Background())
+
+	conn := dial(t, addr)
+	out, _ := io.ReadAll(conn)
+	if string(out) != "> \nsession timed out\n" {
+		t.Errorf("expected the session to time out, got %q instead", out)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	server := NewServer(&REPL{Engine: ENGINE_VM, Prompt: "> "})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(l) }()
+
+	conn := dial(t, l.Addr().String())
+	buf := make([]byte, 2)
+	io.ReadFull(conn, buf) // the session started
+	io.WriteString(conn, "while (true) { }\n")
+	time.Sleep(10 * time.Millisecond) // the execution started, stopped by Shutdown
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected shutdown error: %s", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v instead", err)
+	}
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v instead", err)
+	}
+	if err := server.Serve(l); err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed after shutdown, got %v instead", err)
+	}
+}
+
+func startServer(t *testing.T, shared bool, timeout time.Duration) (*Server, string) {
+	server := NewServer(&REPL{Engine: ENGINE_EVAL, Prompt: "> "})
+	server.Shared = shared
+	server.Timeout = timeout
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	return server, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// output of a session reading input
+func session(t *testing.T, addr, input string) string {
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	io.WriteString(conn, input)
+	conn.(*net.TCPConn).CloseWrite()
+	out, _ := io.ReadAll(conn)
+	return strings.ReplaceAll(string(out), "\r", "")
+}
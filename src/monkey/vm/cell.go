@@ -0,0 +1,39 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+)
+
+const CELL_OBJ = "CELL"
+
+// box of a variable shared between a function and the closures capturing it,
+// the slot of the variable holds the cell instead of the value once captured
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType {
+	return CELL_OBJ
+}
+func (c *cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
+}
+
+// the value of a variable slot
+func load(slot object.Object) object.Object {
+	if c, ok := slot.(*cell); ok {
+		return c.value
+	}
+	return slot
+}
+
+// store val into a variable slot, writing through the cell of a captured variable
+func store(slot *object.Object, val object.Object) {
+	if c, ok := (*slot).(*cell); ok {
+		c.value = val
+		return
+	}
+	*slot = val
+}
@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/code"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+)
+
+// call frame of a closure
+type Frame struct {
+	cl          *object.Closure
+	ip          int // instruction pointer, points to the instruction being executed
+	basePointer int // stack pointer before the call, locals are stored above it
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
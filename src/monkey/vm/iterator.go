@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+)
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// state of a for loop, stored in a slot of its own between the iterations
+type iterator struct {
+	items []object.Object
+	index int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return ITERATOR_OBJ
+}
+func (it *iterator) Inspect() string {
+	return fmt.Sprintf("Iterator[%p]", it)
+}
+
+func (it *iterator) next() (object.Object, bool) {
+	if it.index >= len(it.items) {
+		return nil, false
+	}
+	item := it.items[it.index]
+	it.index += 1
+	return item, true
+}
@@ -0,0 +1,439 @@
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/ast"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/compiler"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5 + 10", 5},
+		{"-50 + 100 + -50", 0},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 7 % 4 * 2", 8},
+		{"let x = 7; x %= 4; x", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"0.5", 0.5},
+		{"-2.5", -2.5},
+		{"1 + 0.5", 1.5},
+		{"1 / 4.0", 0.25},
+		{"10 - 2.5 * 2", 5.0},
+		{"1 == 1.0", true},
+		{"0.5 < 1", true},
+		{"{1: 2}[1.0]", 2},
+		{"5.5 % 2", 1.5},
+		{"1.5 >= 1", true},
+		{"1 <= 0.5", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && 1", 1},
+		{"0 && 1", 1},
+		{"false && 1", false},
+		{"false || 2", 2},
+		{"1 || 2", 1},
+		{"let n = if (false) { 1 }; n || 3", 3},
+		{"let x = 0; false && (x = 1); x", 0},
+		{"let x = 0; true || (x = 1); x", 0},
+		{"let x = 0; true && (x = 1); x", 1},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 >= 3", false},
+		{"let f = fn(n) { n <= 1 || f(n - 1) }; f(5)", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", NULL},
+		{"if (false) { 10 }", NULL},
+		{"if (true) { }", NULL},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"if (true) { let x = 5; }; x", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", NULL},
+		{"[1][-1]", NULL},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", NULL},
+		{`{"one": 1, true: 2}[true]`, 2},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[5]`, NULL},
+		{`let x = 5; "x = ${x}, ${[x, "a"]} ${"in ${x + 1}"}"`, "x = 5, [5, a] in 6"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f();", 15},
+		{"let f = fn() { return 99; 100; }; f();", 99},
+		{"let f = fn() { }; f();", NULL},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let g = 50; let f = fn() { let g = 1; g }; f() + g", 51},
+		{"fn(a) { a * 2 }(3)", 6},
+		{"return 1; 2", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newAdder = fn(a) { fn(b) { a + b } }; let addTwo = newAdder(2); addTwo(3);", 5},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", 6},
+		{
+			`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			let wrapper = fn() { countDown(1); };
+			wrapper();`,
+			0,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } };
+			fib(15);`,
+			610,
+		},
+		{
+			`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			isEven(10)`,
+			true,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("héllo")`, 5},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, NULL},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`puts()`, NULL},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 5) { let i = i + 1; }; i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i", 3},
+		{"let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 2) { continue; } let s = s + i; }; s", 13},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { let s = s + k; }; s`, "ab"},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } let n = n + 1; } }; n", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([1, 2, 3])", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([])", NULL},
+		{"let f = fn() { let s = 0; for (x in [1, 2, 3]) { let s = s + x; } s }; f()", 6},
+		{"let f = fn() { for (x in [1, 2]) { fn() { x } } }; f()", NULL},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { len(1) } catch (e) { e["message"] }`, "argument to `len` not supported, got INTEGER"},
+		{"try { 1 } catch (e) { 2 }", 1},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { throw error("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { throw [1, 2] } catch (e) { e["message"] }`, "[1, 2]"},
+		{`let e = try { throw "x" } catch (err) { err }; e["unknown"]`, NULL},
+		{`let f = fn() { throw 1 + 2 }; try { f() } catch (e) { e["message"] }`, "3"},
+		{`let f = fn(n) { if (n == 0) { throw "deep" } 1 + f(n - 1) }; let r = try { f(10) } catch (e) { 0 }; r + 1`, 1},
+		{`let f = fn() { try { 1 + true } catch (e) { throw e } }; try { f() } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw "a" } catch (e) { try { throw e["message"] + "b" } catch (e) { e["message"] } }`, "ab"},
+		{`let g = fn() { throw "t" }; let f = fn() { try { return g() } catch (e) { "caught" } }; f()`, "caught"},
+		{`let log = ""; let x = try { 1 } finally { log += "f" }; log + "${x}"`, "f1"},
+		{`let log = ""; try { try { throw "a" } finally { log += "f" } } catch (e) { log + e["message"] }`, "fa"},
+		{`let log = ""; try { try { throw "a" } catch (e) { throw "b" } finally { log += "f" } } catch (e) { log + e["message"] }`, "fb"},
+		{`let log = ""; let f = fn() { try { return "r" } finally { log += "f" } }; f() + log`, "rf"},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{`let f = fn() { try { throw "a" } finally { return 1 } }; f()`, 1},
+		{`let log = ""; for (x in [1, 2, 3]) { try { if (x == 2) { continue } log += "${x}" } finally { log += "f" } }; log`, "1ff3f"},
+		{`let log = ""; for (x in [1, 2, 3]) { try { if (x == 2) { break } } finally { log += "${x}" } }; log`, "12"},
+		{`let log = ""; try { for (x in [1, 2]) { if (x == 2) { break } } log += "a" } finally { log += "f" }; log`, "af"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 1; x -= 3; x", -2},
+		{"let x = 3; x *= 3; x", 9},
+		{"let x = 9; x /= 2; x", 4},
+		{"let x = 1; let y = x = 5; x + y", 10},
+		{"let n = 0; let f = fn() { n = n + 5 }; f(); f(); n", 10},
+		{"let f = fn(x) { x *= 2; x }; f(4)", 8},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let n = 0; let g = fn() { fn() { n += 1 } }; g()(); g()(); n }; f()", 2},
+		{"let make = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let p = make(); p[0](); p[0](); p[1]()", 2},
+		{"let f = fn(v) { let x = v; fn() { x } }; let a = f(1); let b = f(2); a() + b() * 10", 21},
+		{"let f = fn() { f = 1; 2 }; f(); f", 1},
+		{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+		{"let a = [1, 2]; a[0] += 10; a[0]", 11},
+		{`let h = {}; h["a"] = 1; h["a"] += 1; h["a"]`, 2},
+		{"let s = 0; let i = 0; while (i < 4) { i += 1; s += i }; s", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: CLOSURE"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"1()", "not a function: INTEGER"},
+		{"fn(a) { a }()", "wrong number of arguments: want=1, got=0"},
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{`"a" <= "b"`, "unknown operator: STRING <= STRING"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{"let f = fn() { f() }; f()", "maximum recursion depth exceeded"},
+		{"for (x in 1) { x }", "cannot iterate over INTEGER"},
+		{"let a = [1]; a[5] = 1", "index out of range: 5"},
+		{`let s = "a"; s[0] = "b"`, "index assignment not supported: STRING"},
+		{`throw "boom"`, "boom"},
+		{`try { throw "a" } finally { 1 }`, "a"},
+		{`let f = fn() { throw "a" }; try { f() } catch (e) { e + 1 }`, "type mismatch: ERROR_VALUE + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected vm error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          object.Limits
+		expectedMessage string // "" if the execution succeeds
+	}{
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.Limits{MaxDepth: 11}, ""},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.Limits{MaxDepth: 10}, "maximum recursion depth exceeded"},
+		// the stack grows up to the depth limit
+		{"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(3000)", object.Limits{MaxDepth: 5000}, ""},
+		{"let f = fn(n) { f(n + 1) + 1 }; try { f(0) } catch (e) { 1 }", object.Limits{}, "maximum recursion depth exceeded"},
+		{"while (true) { }", object.Limits{MaxSteps: 1000}, "maximum number of steps exceeded"},
+		{"while (true) { }", object.Limits{Timeout: time.Millisecond}, "execution timed out"},
+		{`"a" + "b"`, object.Limits{MaxMemory: 100}, ""},
+		{`let i = 0; while (i < 1000) { "abcdefgh"; i += 1 }`, object.Limits{MaxMemory: 100}, ""},
+		{`let s = "ab"; while (true) { s = s + s }`, object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{`let s = "ab"; while (true) { s = "${s}${s}" }`, object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let a = []; while (true) { a = push(a, 1) }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"while (true) { [1, 2, 3] }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let h = {}; let i = 0; while (true) { h[i] = i; i += 1 }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let h = {}; while (true) { h[1] = 1 }", object.Limits{MaxMemory: 1 << 20, MaxSteps: 100000}, "maximum number of steps exceeded"},
+		// the limits can't be caught
+		{"try { while (true) { } } catch (e) { 1 }", object.Limits{MaxSteps: 1000}, "maximum number of steps exceeded"},
+		{"let a = []; try { while (true) { a = push(a, 1) } } catch (e) { 1 }", object.Limits{MaxMemory: 1 << 20}, "memory quota exceeded"},
+		{"let f = fn() { 1 + f() }; try { f() } finally { 1 }", object.Limits{MaxDepth: 10}, "maximum recursion depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		rt := object.NewRuntime()
+		rt.Limits = tt.limits
+		vm := New(comp.Bytecode())
+		vm.SetRuntime(rt)
+		end := rt.Begin(context.Background())
+		err := vm.Run()
+		end()
+
+		if tt.expectedMessage == "" {
+			if err != nil {
+				t.Errorf("unexpected vm error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected vm error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%q: expected Integer %d, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case float64:
+		float, ok := actual.(*object.Float)
+		if !ok || float.Value != expected {
+			t.Errorf("%q: expected Float %g, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("%q: expected Boolean %t, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%q: expected String %q, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: expected Array %v, got=%T (%+v)", input, expected, actual, actual)
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, input, el, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != NULL {
+			t.Errorf("%q: expected NULL, got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/lexer"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/object"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/parser"
+)
+
+// exit status
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1 // parse or runtime error
+	EXIT_USAGE = 2
+)
+
+func runFile(filename string, args []string, options monkey.Options) int {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		return EXIT_ERROR
+	}
+	return runSource(filename, string(src), args, options, false)
+}
+
+// runSource evaluates src with the script arguments bound to `args`
+func runSource(filename, src string, args []string, options monkey.Options, printResult bool) int {
+	l := lexer.NewFile(filename, src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Diagnostics()) != 0 {
+		for _, d := range p.Diagnostics() {
+			io.WriteString(os.Stderr, d.Excerpt(src))
+		}
+		return EXIT_ERROR
+	}
+
+	interp := monkey.New(options)
+	interp.Set("args", scriptArgs(args))
+	evaluated, err := interp.Run(program)
+	if err != nil {
+		var rerr *monkey.RuntimeError
+		if errors.As(err, &rerr) {
+			fmt.Fprintln(os.Stderr, rerr.Err.Traceback())
+		} else {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		return EXIT_ERROR
+	}
+	if printResult && evaluated != nil && evaluated.Type() != object.NULL_OBJ {
+		fmt.Println(evaluated.Inspect())
+	}
+
+	return EXIT_OK
+}
+
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, 0, len(args))
+	for _, arg := range args {
+		elements = append(elements, &object.String{Value: arg})
+	}
+	return &object.Array{Elements: elements}
+}
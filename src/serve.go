@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey"
+	"github.com/pqppq/writing-an-interpreter-in-go/monkey/repl"
+)
+
+// time given to the sessions to end on SIGINT or SIGTERM
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// serve runs `monkey serve [options]`, a REPL session for every connection
+func serve(args []string, options monkey.Options) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = flag.Usage
+	listen := flags.String("listen", "localhost:4000", "tcp `address`, or unix:path of a socket")
+	shared := flags.Bool("shared", false, "share one environment between the sessions")
+	timeout := flags.Duration("timeout", 0, "close the sessions idle for `duration`")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	network, address := "tcp", *listen
+	if path, ok := strings.CutPrefix(*listen, "unix:"); ok {
+		network, address = "unix", path
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		return EXIT_ERROR
+	}
+
+	r := repl.New(options.Engine)
+	r.Limits = options.Limits
+	r.Banner = "This is the Monkey programming language!\n"
+	server := repl.NewServer(r)
+	server.Shared = *shared
+	server.Timeout = *timeout
+
+	shutdown := make(chan error, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "monkey: serving on %s %s\n", network, l.Addr())
+	if err := server.Serve(l); err != repl.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		return EXIT_ERROR
+	}
+	if err := <-shutdown; err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: shutdown: %s\n", err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}